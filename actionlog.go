@@ -0,0 +1,305 @@
+package transfig
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrNoActionLog is returned when traveling through or exporting the action
+// log of a State that is not recording one.
+var ErrNoActionLog = errors.New("action log is not enabled")
+
+// Action is an entry of the action log: the changes made by a single commit
+// (a Set, a ClearNested, a Batch...).
+type Action struct {
+	// Seq is the sequence number of the commit, as in ChangeEvent.
+	Seq  uint64
+	Time time.Time
+	// Label is the label given to the Batch that made the changes, if any.
+	Label   string
+	Changes []Change
+}
+
+// copy returns a copy of the action that shares no values with it
+func (a Action) copy() Action {
+	changes := make([]Change, len(a.Changes))
+	for i, c := range a.Changes {
+		changes[i] = c.copy()
+	}
+	a.Changes = changes
+	return a
+}
+
+// actionLog records the actions of a State. Since the state values are never
+// modified in place, the log keeps the values right after every action, which
+// makes traveling to any of them cheap.
+type actionLog struct {
+	base     *pmap
+	actions  []Action
+	values   []*pmap
+	position int
+	now      func() time.Time
+}
+
+// record appends an action with the changes made by a commit, discarding the
+// actions after the current position, if the state traveled back.
+func (l *actionLog) record(action Action, values *pmap) {
+	l.actions = append(l.actions[:l.position], action)
+	l.values = append(l.values[:l.position], values)
+	l.position++
+}
+
+// valuesAt returns the values right after the `n`-th action
+func (l *actionLog) valuesAt(n int) *pmap {
+	if n == 0 {
+		return l.base
+	}
+	return l.values[n-1]
+}
+
+// TravelMode defines how subscriptions are notified while traveling through
+// the action log.
+type TravelMode int
+
+const (
+	// TravelJump notifies subscriptions once, with the changes between the
+	// current values and the values traveled to.
+	TravelJump TravelMode = iota
+	// TravelReplay notifies subscriptions of every action traveled through,
+	// one at a time, as if they were being made (or undone) again.
+	TravelReplay
+	// TravelMute does not notify subscriptions at all.
+	TravelMute
+)
+
+// EnableActionLog starts recording every change to the state in an action
+// log, from the current values. Every commit is recorded as one Action, and a
+// Batch can label its action with Tx.Label. Calling EnableActionLog again
+// discards the recorded log.
+//
+// The log can be traveled through with TravelTo, StepBack and StepForward. A
+// change made after traveling back discards the actions after the current
+// position, as in Redo.
+func (s *State) EnableActionLog() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actionLog = &actionLog{base: s.values, now: time.Now}
+}
+
+// logAction records the changes made by a commit in the action log, if it is
+// enabled. Must be called with the write lock held.
+func (s *State) logAction(changes []applied, label string) {
+	if s.actionLog == nil || len(changes) == 0 {
+		return
+	}
+	s.actionLog.record(Action{Seq: s.seq, Time: s.actionLog.now(), Label: label, Changes: appliedChanges(changes)}, s.values)
+}
+
+// appliedChanges returns the Change of each of `changes`
+func appliedChanges(changes []applied) []Change {
+	result := make([]Change, len(changes))
+	for i, c := range changes {
+		result[i] = c.Change
+	}
+	return result
+}
+
+// Actions returns a copy of the recorded actions, or nil if the action log is
+// not enabled
+func (s *State) Actions() []Action {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.actionLog == nil {
+		return nil
+	}
+	actions := make([]Action, len(s.actionLog.actions))
+	for i, a := range s.actionLog.actions {
+		actions[i] = a.copy()
+	}
+	return actions
+}
+
+// ActionPosition returns the number of recorded actions applied to the state,
+// which is the number of actions unless the state traveled back
+func (s *State) ActionPosition() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.actionLog == nil {
+		return 0
+	}
+	return s.actionLog.position
+}
+
+// TravelTo sets the state values to the ones right after the `n`-th recorded
+// action, or to the ones the log started from if `n` is zero. Subscriptions
+// are notified according to `mode`. Traveling is not recorded in the undo
+// history. Returns an error if `n` is out of range or if the values don't
+// match the current schema.
+func (s *State) TravelTo(n int, mode TravelMode) error {
+	return s.update(func(chain []string) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.travel(n, mode, chain)
+	})
+}
+
+// StepBack travels to the action before the current position and returns
+// true, or returns false if there is none
+func (s *State) StepBack(mode TravelMode) bool {
+	return s.step(-1, mode)
+}
+
+// StepForward travels to the action after the current position and returns
+// true, or returns false if there is none
+func (s *State) StepForward(mode TravelMode) bool {
+	return s.step(1, mode)
+}
+
+// step implements StepBack and StepForward
+func (s *State) step(delta int, mode TravelMode) bool {
+	stepped := true
+	err := s.update(func(chain []string) error {
+		s.mu.Lock()
+		l := s.actionLog
+		stepped = l != nil && l.position+delta >= 0 && l.position+delta <= len(l.actions)
+		var err error
+		if stepped {
+			err = s.travel(l.position+delta, mode, chain)
+		}
+		s.mu.Unlock()
+		return err
+	})
+	return stepped && err == nil
+}
+
+// travel implements TravelTo, as part of the cascade `chain`. Must be called
+// with the write lock held.
+func (s *State) travel(n int, mode TravelMode, chain []string) error {
+	l := s.actionLog
+	if l == nil {
+		return ErrNoActionLog
+	}
+	if n < 0 || n > len(l.actions) {
+		return fmt.Errorf("can't travel to action %d: the log has %d actions", n, len(l.actions))
+	}
+	pending := len(s.pending)
+	steps := []int{n}
+	if mode == TravelReplay {
+		steps = []int{}
+		for i := l.position; i != n; {
+			if i < n {
+				i++
+			} else {
+				i--
+			}
+			steps = append(steps, i)
+		}
+	}
+	var err error
+	for _, step := range steps {
+		if _, err = s.mutate(changeMutations(pmapDiff(Path{}, s.values, l.valuesAt(step))), chain); err != nil {
+			break
+		}
+		l.position = step
+	}
+	if mode == TravelMute {
+		s.queued -= uint64(len(s.pending) - pending)
+		s.pending = s.pending[:pending]
+	}
+	return err
+}
+
+// actionJSON is how an Action is written by WriteActionLog
+type actionJSON struct {
+	Seq   uint64          `json:"seq"`
+	Time  time.Time       `json:"time"`
+	Label string          `json:"label,omitempty"`
+	Patch json.RawMessage `json:"patch"`
+}
+
+// WriteActionLog writes the action log to `w` as JSON lines: the first line
+// holds the values the log started from, and every other line holds an
+// action, with its changes as a RFC 6902 JSON Patch. All the recorded actions
+// are written, regardless of the current position.
+func (s *State) WriteActionLog(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.actionLog == nil {
+		return ErrNoActionLog
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(s.actionLog.base); err != nil {
+		return fmt.Errorf("can't write action log: %w", err)
+	}
+	for i, a := range s.actionLog.actions {
+		patch, err := JSONPatch(a.Changes)
+		if err != nil {
+			return fmt.Errorf("can't write action %d: %w", i+1, err)
+		}
+		if err := encoder.Encode(actionJSON{Seq: a.Seq, Time: a.Time, Label: a.Label, Patch: patch}); err != nil {
+			return fmt.Errorf("can't write action %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// NewStateFromActionLog creates a new state from an action log written by
+// WriteActionLog. The state is rebuilt by replaying all the actions, with its
+// action log enabled, so that it can be traveled through. The recorded
+// actions keep the sequence numbers, times and labels read from `r`, and the
+// state continues from the sequence number of the last one.
+func NewStateFromActionLog(r io.Reader) (*State, error) {
+	return NewStateFromActionLogWithSchema(r, nil)
+}
+
+// NewStateFromActionLogWithSchema is like NewStateFromActionLog, but the state
+// has the given schema attached, and the values read from `r` are decoded
+// guided by it, as in ParseJSONPatchWithSchema. Returns an error if the
+// values don't match the schema.
+func NewStateFromActionLogWithSchema(r io.Reader, schema Schema) (*State, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("can't read action log: %w", err)
+		}
+		return nil, fmt.Errorf("can't read action log: missing initial values")
+	}
+	base, err := jsonDecodeObject(Path{}, scanner.Bytes(), schema)
+	if err != nil {
+		return nil, fmt.Errorf("can't read action log: %w", err)
+	}
+	s, err := NewStateFromMapWithSchema(base, schema)
+	if err != nil {
+		return nil, fmt.Errorf("can't read action log: %w", err)
+	}
+	s.EnableActionLog()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 1; scanner.Scan(); i++ {
+		var a actionJSON
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return nil, fmt.Errorf("can't read action %d: %w", i, err)
+		}
+		changes, err := ParseJSONPatchWithSchema(a.Patch, schema)
+		if err != nil {
+			return nil, fmt.Errorf("can't read action %d: %w", i, err)
+		}
+		applied, err := s.mutate(changeMutations(changes), nil)
+		if err != nil {
+			return nil, fmt.Errorf("can't replay action %d: %w", i, err)
+		}
+		if len(applied) > 0 {
+			s.seq = a.Seq
+			s.actionLog.record(Action{Seq: a.Seq, Time: a.Time, Label: a.Label, Changes: appliedChanges(applied)}, s.values)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read action log: %w", err)
+	}
+	return s, nil
+}
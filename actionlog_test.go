@@ -0,0 +1,184 @@
+package transfig_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+// recordedState returns a state with three recorded actions
+func recordedState() *State {
+	state := DefaultState()
+	state.EnableActionLog()
+	state.Set(Name, "Mike")
+	_ = state.Batch(func(tx *Tx) error {
+		tx.Label("new job")
+		tx.SetNested(Path{Job, Title}, "Developer")
+		tx.Set(Age, 31)
+		return nil
+	})
+	state.ClearNested(Path{Age})
+	return state
+}
+
+func Test_ActionLog_Records(t *testing.T) {
+	state := recordedState()
+	actions := state.Actions()
+	assert.Len(t, actions, 3)
+	assert.Equal(t, 3, state.ActionPosition())
+	assert.Equal(t, []Change{{Op: OpSet, Path: Path{Name}, OldValue: "John", NewValue: "Mike", Existed: true}}, actions[0].Changes)
+	assert.Equal(t, "new job", actions[1].Label)
+	assert.Len(t, actions[1].Changes, 2)
+	assert.Equal(t, OpClear, actions[2].Changes[0].Op)
+	assert.Less(t, actions[0].Seq, actions[1].Seq)
+	assert.False(t, actions[1].Time.Before(actions[0].Time))
+}
+
+func Test_ActionLog_Disabled(t *testing.T) {
+	state := DefaultState()
+	state.Set(Name, "Mike")
+	assert.Nil(t, state.Actions())
+	assert.ErrorIs(t, state.TravelTo(0, TravelJump), ErrNoActionLog)
+	assert.False(t, state.StepBack(TravelJump))
+	assert.ErrorIs(t, state.WriteActionLog(&bytes.Buffer{}), ErrNoActionLog)
+}
+
+func Test_ActionLog_TravelTo(t *testing.T) {
+	state := recordedState()
+	assert.NoError(t, state.TravelTo(1, TravelJump))
+	assert.Equal(t, CallbackArgs{Name: "Mike", Age: 30}, state.AsMap())
+	assert.Equal(t, 1, state.ActionPosition())
+	assert.NoError(t, state.TravelTo(0, TravelJump))
+	assert.Equal(t, CallbackArgs{Name: "John", Age: 30}, state.AsMap())
+	assert.NoError(t, state.TravelTo(2, TravelJump))
+	assert.Equal(t, CallbackArgs{Name: "Mike", Age: 31, Job: map[KeyString]interface{}{Title: "Developer"}}, state.AsMap())
+	assert.Error(t, state.TravelTo(4, TravelJump))
+	assert.Len(t, state.Actions(), 3)
+}
+
+func Test_ActionLog_Step(t *testing.T) {
+	state := recordedState()
+	assert.False(t, state.StepForward(TravelJump))
+	assert.True(t, state.StepBack(TravelJump))
+	age, _ := state.Get(Age)
+	assert.Equal(t, 31, age)
+	assert.True(t, state.StepBack(TravelJump))
+	assert.True(t, state.StepBack(TravelJump))
+	assert.False(t, state.StepBack(TravelJump))
+	assert.True(t, state.StepForward(TravelJump))
+	name, _ := state.Get(Name)
+	assert.Equal(t, "Mike", name)
+}
+
+func Test_ActionLog_TravelModes(t *testing.T) {
+	for mode, expected := range map[TravelMode][]interface{}{
+		TravelJump:   {30},
+		TravelReplay: {31, 30},
+		TravelMute:   nil,
+	} {
+		state := recordedState()
+		var ages []interface{}
+		sub := NewSubscription("subName").With(Age).Calls(func(args CallbackArgs) {
+			ages = append(ages, args[Age])
+		})
+		state.Subscribe(sub)
+		assert.NoError(t, state.TravelTo(1, mode))
+		assert.Equal(t, expected, ages, "mode %d", mode)
+		assert.Equal(t, CallbackArgs{Name: "Mike", Age: 30}, state.AsMap())
+	}
+}
+
+func Test_ActionLog_TravelJumpNotifiesOnce(t *testing.T) {
+	state := recordedState()
+	calls := 0
+	state.Subscribe(NewSubscription("subName").With(Wildcard{}).Calls(func(CallbackArgs) { calls++ }))
+	assert.NoError(t, state.TravelTo(0, TravelJump))
+	assert.Equal(t, 1, calls)
+}
+
+func Test_ActionLog_ChangeAfterTravelDiscardsFuture(t *testing.T) {
+	state := recordedState()
+	assert.NoError(t, state.TravelTo(1, TravelMute))
+	state.Set(Name, "Paul")
+	actions := state.Actions()
+	assert.Len(t, actions, 2)
+	assert.Equal(t, "Paul", actions[1].Changes[0].NewValue)
+	assert.Equal(t, 2, state.ActionPosition())
+}
+
+func Test_ActionLog_RecordsUndo(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(0)
+	state.EnableActionLog()
+	state.Set(Name, "Mike")
+	state.Undo()
+	assert.Len(t, state.Actions(), 2)
+	assert.NoError(t, state.TravelTo(1, TravelJump))
+	name, _ := state.Get(Name)
+	assert.Equal(t, "Mike", name)
+}
+
+func Test_ActionLog_WriteAndRead(t *testing.T) {
+	state := recordedState()
+	buf := &bytes.Buffer{}
+	assert.NoError(t, state.WriteActionLog(buf))
+	assert.Equal(t, 4, bytes.Count(buf.Bytes(), []byte("\n")))
+	loaded, err := NewStateFromActionLog(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, state.AsMap(), loaded.AsMap())
+	actions, loadedActions := state.Actions(), loaded.Actions()
+	assert.Len(t, loadedActions, 3)
+	for i := range actions {
+		assert.Equal(t, actions[i].Seq, loadedActions[i].Seq)
+		assert.True(t, actions[i].Time.Equal(loadedActions[i].Time))
+		assert.Equal(t, actions[i].Label, loadedActions[i].Label)
+		assert.Equal(t, actions[i].Changes, loadedActions[i].Changes)
+	}
+	assert.NoError(t, loaded.TravelTo(0, TravelJump))
+	assert.Equal(t, CallbackArgs{Name: "John", Age: 30}, loaded.AsMap())
+}
+
+func Test_ActionLog_ReadContinuesSeq(t *testing.T) {
+	state := recordedState()
+	buf := &bytes.Buffer{}
+	assert.NoError(t, state.WriteActionLog(buf))
+	loaded, err := NewStateFromActionLog(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, state.Snapshot().Seq(), loaded.Snapshot().Seq())
+	loaded.Set(Name, "Anna")
+	actions := loaded.Actions()
+	assert.Equal(t, actions[2].Seq+1, actions[3].Seq)
+}
+
+func Test_ActionLog_ReadWithSchema(t *testing.T) {
+	Tags := KeyString("tags")
+	schema := Schema{
+		Name: {Type: reflect.TypeOf("")},
+		Age:  {Type: reflect.TypeOf(float64(0))},
+		Tags: {Type: reflect.TypeOf([]string{})},
+	}
+	state, err := NewStateFromMapWithSchema(map[KeyString]interface{}{Name: "John", Age: 30.0}, schema)
+	assert.NoError(t, err)
+	state.EnableActionLog()
+	state.Set(Age, 31.0)
+	state.Set(Tags, []string{"a", "b"})
+	buf := &bytes.Buffer{}
+	assert.NoError(t, state.WriteActionLog(buf))
+	loaded, err := NewStateFromActionLogWithSchema(buf, schema)
+	assert.NoError(t, err)
+	assert.Equal(t, state.AsMap(), loaded.AsMap())
+	assert.Equal(t, schema, loaded.Schema())
+	assert.NoError(t, loaded.TravelTo(0, TravelJump))
+	age, _ := loaded.Get(Age)
+	assert.Equal(t, 30.0, age)
+}
+
+func Test_ActionLog_ReadInvalid(t *testing.T) {
+	_, err := NewStateFromActionLog(bytes.NewBufferString(""))
+	assert.Error(t, err)
+	_, err = NewStateFromActionLog(bytes.NewBufferString("{}\n{\"patch\": 1}\n"))
+	assert.ErrorContains(t, err, "action 1")
+}
@@ -0,0 +1,67 @@
+package transfig
+
+// Tx is a set of changes to a State that are applied together by
+// State.Batch. Reads made through a Tx see the changes made so far in it,
+// while the State itself only sees them once the transaction is committed.
+type Tx struct {
+	state     *State
+	values    *pmap
+	mutations []mutation
+	label     string
+}
+
+// Label sets the label of the transaction in the action log
+func (tx *Tx) Label(label string) {
+	tx.label = label
+}
+
+// Set stages a new value for a specific key
+func (tx *Tx) Set(key KeyString, value interface{}) {
+	tx.SetNested(Path{key}, value)
+}
+
+// SetNested stages a new value for a nested key
+func (tx *Tx) SetNested(path Path, value interface{}) {
+	tx.stage(mutation{op: OpSet, path: path, value: value})
+}
+
+// ClearNested stages the removal of a nested key
+func (tx *Tx) ClearNested(path Path) {
+	tx.stage(mutation{op: OpClear, path: path})
+}
+
+// Get returns the value for a specific key, as seen by the transaction
+func (tx *Tx) Get(key KeyString) (value interface{}, found bool) {
+	return tx.GetNested(key)
+}
+
+// GetNested returns the value for a nested key, as seen by the transaction
+func (tx *Tx) GetNested(keys ...KeyString) (value interface{}, found bool) {
+	if tx.values == nil {
+		return tx.state.GetNested(keys...)
+	}
+	value, found = pmapGetNested(tx.values, keys)
+	return valueCopy(value), found
+}
+
+func (tx *Tx) stage(m mutation) {
+	if tx.values == nil {
+		tx.values = tx.state.Snapshot().values
+	}
+	m.value = valueCopy(m.value)
+	tx.values, _, _ = m.apply(tx.values)
+	tx.mutations = append(tx.mutations, m)
+}
+
+// Batch runs `fn` with a new transaction and, if it returns nil, commits all
+// the changes staged in the transaction at once. Every subscription affected
+// by the changes is notified exactly once, with the final values. If `fn`
+// returns an error, or if a middleware rejects any of the changes, nothing is
+// changed and the error is returned.
+func (s *State) Batch(fn func(tx *Tx) error) error {
+	tx := &Tx{state: s}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return s.commitLabeled(tx.mutations, tx.label)
+}
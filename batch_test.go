@@ -0,0 +1,90 @@
+package transfig_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_Batch_NotifiesOnceWithFinalValues(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	callbackArgs := make(map[KeyString]interface{})
+	callback := func(args CallbackArgs) {
+		callCount++
+		callbackArgs = args
+	}
+	sub := NewSubscription("subName").With(Job).With(Name).Calls(callback)
+	state.Subscribe(sub)
+
+	err := state.Batch(func(tx *Tx) error {
+		tx.SetNested(Path{Job, Title}, "Developer")
+		tx.SetNested(Path{Job, Compensation, Ammount}, 1000)
+		tx.Set(Name, "Mike")
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, callCount)
+	expCallArgs := map[KeyString]interface{}{
+		Name: "Mike",
+		Job: map[KeyString]interface{}{
+			Title:        "Developer",
+			Compensation: map[KeyString]interface{}{Ammount: 1000},
+		},
+	}
+	assert.Equal(t, expCallArgs, callbackArgs)
+}
+
+func Test_Batch_ChangesNotVisibleBeforeCommit(t *testing.T) {
+	state := DefaultState()
+	_ = state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "Mike")
+		stateValue, _ := state.Get(Name)
+		assert.Equal(t, "John", stateValue)
+		txValue, _ := tx.Get(Name)
+		assert.Equal(t, "Mike", txValue)
+		tx.ClearNested(Path{Age})
+		_, found := tx.Get(Age)
+		assert.False(t, found)
+		return nil
+	})
+	value, _ := state.Get(Name)
+	assert.Equal(t, "Mike", value)
+	_, found := state.Get(Age)
+	assert.False(t, found)
+}
+
+func Test_Batch_ErrorRollsBack(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	sub := NewSubscription("subName").With(Wildcard{}).Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	expErr := errors.New("failed")
+
+	err := state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "Mike")
+		tx.ClearNested(Path{Age})
+		return expErr
+	})
+
+	assert.ErrorIs(t, err, expErr)
+	assert.Equal(t, 0, callCount)
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
+
+func Test_Batch_NoChangesDoesNotNotify(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	sub := NewSubscription("subName").With(Wildcard{}).Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	err := state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "John")
+		tx.ClearNested(Path{MissingKey})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, callCount)
+}
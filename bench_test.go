@@ -0,0 +1,105 @@
+package transfig_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// stateWithSubscriptions returns a state with `n` subscriptions, each one
+// subscribed to a different nested path.
+func stateWithSubscriptions(n int) *State {
+	state := NewState()
+	for i := 0; i < n; i++ {
+		key := KeyString(fmt.Sprintf("key%d", i))
+		sub := NewSubscription(string(key)).WithNested(Job, key).Calls(func(CallbackArgs) {})
+		state.Subscribe(sub)
+	}
+	return state
+}
+
+func Benchmark_SetNested_Subscriptions(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			state := stateWithSubscriptions(n)
+			path := Path{Job, KeyString("key0")}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state.SetNested(path, i)
+			}
+		})
+	}
+}
+
+func Benchmark_SetNested_SubscriptionsNoMatch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			state := stateWithSubscriptions(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state.Set(Name, i)
+			}
+		})
+	}
+}
+
+// largeState returns a state with `n` keys, each one holding a small map
+func largeState(n int) *State {
+	state := NewState()
+	for i := 0; i < n; i++ {
+		state.Set(KeyString(fmt.Sprintf("key%d", i)), map[KeyString]interface{}{Name: "John", Age: i})
+	}
+	return state
+}
+
+func Benchmark_AsMap(b *testing.B) {
+	state := largeState(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.AsMap()
+	}
+}
+
+func Benchmark_Snapshot(b *testing.B) {
+	state := largeState(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.Snapshot()
+	}
+}
+
+// wideState returns a state with `n` top-level keys
+func wideState(n int) *State {
+	m := make(map[KeyString]interface{}, n)
+	for i := 0; i < n; i++ {
+		m[KeyString(fmt.Sprintf("key%d", i))] = i
+	}
+	return NewStateFromMap(m)
+}
+
+func Benchmark_Set_WideState(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			state := wideState(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state.Set("key0", i)
+			}
+		})
+	}
+}
+
+func Benchmark_SetNested_WideState(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			state := wideState(n)
+			state.Set(Job, map[KeyString]interface{}{Name: "John"})
+			path := Path{Job, Name}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state.SetNested(path, i)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package transfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxCascadeDepth is the maximum cascade depth of a State that didn't
+// set one
+const DefaultMaxCascadeDepth = 100
+
+// CascadeError is reported when a mutation made by a callback would make a
+// cascade of mutations deeper than the maximum depth of the State. It is
+// usually caused by subscriptions that keep changing each other's values.
+type CascadeError struct {
+	// Subscriptions are the names of the subscriptions whose callbacks made
+	// the mutations of the cascade, in order.
+	Subscriptions []string
+}
+
+func (e *CascadeError) Error() string {
+	msg := fmt.Sprintf("cascade of %d mutations made by callbacks", len(e.Subscriptions))
+	if cycle := e.Cycle(); cycle != nil {
+		return msg + ": cycle " + strings.Join(cycle, " -> ")
+	}
+	return msg + ": " + strings.Join(e.Subscriptions, " -> ")
+}
+
+// Cycle returns the first sequence of subscriptions in the cascade that
+// starts and ends with the same subscription, or nil if there is none
+func (e *CascadeError) Cycle() []string {
+	seen := map[string]int{}
+	for i, name := range e.Subscriptions {
+		if j, found := seen[name]; found {
+			return e.Subscriptions[j : i+1]
+		}
+		seen[name] = i
+	}
+	return nil
+}
+
+// SetMaxCascadeDepth sets the maximum depth of a cascade of mutations made by
+// callbacks. A mutation made by the callback of a notification caused by
+// another mutation made by a callback, and so on, more than `depth` times, is
+// rejected with a CascadeError, which is reported to the OnError handler (or
+// to the standard logger) along with the name of the subscription whose
+// callback made the mutation. A `depth` of zero or less disables the limit.
+//
+// Cascades can only be told when notifications are delivered by
+// SyncDispatcher. Mutations made by callbacks run by any other dispatcher
+// start a new cascade.
+func (s *State) SetMaxCascadeDepth(depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if depth <= 0 {
+		depth = -1
+	}
+	s.maxCascade = depth
+}
+
+// cascade returns the names of the subscriptions whose callbacks led to the
+// notification being dispatched, including its own, or nil if none is. Must
+// be called with the lock held.
+func (s *State) cascade() []string {
+	if s.dispatching == nil {
+		return nil
+	}
+	chain := make([]string, 0, len(s.dispatching.chain)+1)
+	chain = append(chain, s.dispatching.chain...)
+	return append(chain, s.dispatching.sub.name)
+}
+
+// checkCascade returns a CascadeError if a mutation made as part of the
+// cascade `chain` would make it deeper than the maximum. Must be called with
+// the lock held.
+func (s *State) checkCascade(chain []string) error {
+	max := s.maxCascade
+	if max == 0 {
+		max = DefaultMaxCascadeDepth
+	}
+	if max > 0 && len(chain) > max {
+		return &CascadeError{Subscriptions: chain}
+	}
+	return nil
+}
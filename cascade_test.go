@@ -0,0 +1,145 @@
+package transfig_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+// cascadeErrors collects the errors reported by a state
+func cascadeErrors(state *State) *[]error {
+	errs := &[]error{}
+	state.OnError(func(subName string, err error) { *errs = append(*errs, err) })
+	return errs
+}
+
+func Test_Cascade_DeliveredAfterCurrentRound(t *testing.T) {
+	state := DefaultState()
+	calls := []string{}
+	state.Subscribe(NewSubscription("first").With(Name).Calls(func(args CallbackArgs) {
+		calls = append(calls, "first")
+		state.Set(Age, 31)
+		age, _ := state.Get(Age)
+		assert.Equal(t, 30, age)
+	}))
+	state.Subscribe(NewSubscription("second").With(Name).Calls(func(args CallbackArgs) {
+		age, _ := state.Get(Age)
+		calls = append(calls, "second")
+		assert.Equal(t, 30, age)
+	}))
+	state.Subscribe(NewSubscription("age").With(Age).Calls(func(args CallbackArgs) {
+		calls = append(calls, "age")
+		assert.Equal(t, 31, args[Age])
+	}))
+	state.Set(Name, "Mike")
+	assert.Equal(t, []string{"first", "second", "age"}, calls)
+	age, _ := state.Get(Age)
+	assert.Equal(t, 31, age)
+}
+
+func Test_Cascade_CycleRejected(t *testing.T) {
+	state := DefaultState()
+	state.SetMaxCascadeDepth(10)
+	var errs []error
+	var subNames []string
+	state.OnError(func(subName string, err error) {
+		subNames = append(subNames, subName)
+		errs = append(errs, err)
+	})
+	state.Subscribe(NewSubscription("ping").With(Name).Calls(func(args CallbackArgs) {
+		assert.NoError(t, state.TrySet(Age, len(args[Name].(string))))
+	}))
+	state.Subscribe(NewSubscription("pong").With(Age).Calls(func(args CallbackArgs) {
+		name, _ := state.Get(Name)
+		state.Set(Name, name.(string)+"x")
+	}))
+	state.Set(Name, "Mike")
+	assert.Len(t, errs, 1)
+	var cascadeErr *CascadeError
+	assert.True(t, errors.As(errs[0], &cascadeErr))
+	assert.Len(t, cascadeErr.Subscriptions, 11)
+	assert.Len(t, cascadeErr.Cycle(), 3)
+	assert.Contains(t, cascadeErr.Error(), "cycle")
+	assert.Contains(t, cascadeErr.Error(), "ping")
+	assert.Contains(t, cascadeErr.Error(), "pong")
+	assert.Equal(t, []string{"ping"}, subNames)
+}
+
+func Test_Cascade_DepthLimit(t *testing.T) {
+	state := DefaultState()
+	state.SetMaxCascadeDepth(3)
+	errs := cascadeErrors(state)
+	state.Subscribe(NewSubscription("counter").With(Age).Calls(func(args CallbackArgs) {
+		state.Set(Age, args[Age].(int)+1)
+	}))
+	state.Set(Age, 0)
+	age, _ := state.Get(Age)
+	assert.Equal(t, 3, age)
+	assert.Len(t, *errs, 1)
+	assert.Equal(t, "cascade of 4 mutations made by callbacks: cycle counter -> counter", (*errs)[0].Error())
+}
+
+func Test_Cascade_ErrorLoggedWithoutHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(buf)
+	state := DefaultState()
+	state.SetMaxCascadeDepth(1)
+	state.Subscribe(NewSubscription("counter").With(Age).Calls(func(args CallbackArgs) {
+		state.Set(Age, args[Age].(int)+1)
+	}))
+	state.Set(Age, 0)
+	assert.Contains(t, buf.String(), `subscription "counter": cascade of 2 mutations made by callbacks`)
+}
+
+func Test_Cascade_Unlimited(t *testing.T) {
+	state := DefaultState()
+	state.SetMaxCascadeDepth(0)
+	errs := cascadeErrors(state)
+	state.Subscribe(NewSubscription("counter").With(Age).Calls(func(args CallbackArgs) {
+		if age := args[Age].(int); age < 500 {
+			state.Set(Age, age+1)
+		}
+	}))
+	state.Set(Age, 0)
+	age, _ := state.Get(Age)
+	assert.Equal(t, 500, age)
+	assert.Empty(t, *errs)
+}
+
+func Test_Cascade_NewChainOutsideCallbacks(t *testing.T) {
+	state := DefaultState()
+	state.SetMaxCascadeDepth(1)
+	errs := cascadeErrors(state)
+	state.Subscribe(NewSubscription("counter").With(Age).Calls(func(args CallbackArgs) {
+		state.Set(Age, args[Age].(int)+1)
+	}))
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, state.TrySet(Age, i*10))
+		age, _ := state.Get(Age)
+		assert.Equal(t, i*10+1, age)
+	}
+	assert.Len(t, *errs, 5)
+}
+
+func Test_Cascade_ErrorsOfQueuedMutationsReported(t *testing.T) {
+	state := DefaultState()
+	errs := cascadeErrors(state)
+	state.Use(func(next ChangeHandler) ChangeHandler {
+		return func(c Change) error {
+			if c.Path.Contains(Path{Age}) && c.NewValue == -1 {
+				return errRejected
+			}
+			return next(c)
+		}
+	})
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(args CallbackArgs) {
+		assert.NoError(t, state.TrySet(Age, -1))
+	}))
+	state.Set(Name, "Mike")
+	assert.Equal(t, []error{errRejected}, *errs)
+}
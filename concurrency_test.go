@@ -0,0 +1,181 @@
+package transfig_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+// These tests are meant to be run with the race detector (`make test-race`).
+
+func Test_Concurrent_SetAndGet(t *testing.T) {
+	state := DefaultState()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				state.SetNested(Path{Job, KeyString(fmt.Sprint(i))}, j)
+				state.ClearNested(Path{Age})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				state.GetNested(Job, Title)
+				state.Get(Name)
+				state.AsMap()
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		value, found := state.GetNested(Job, KeyString(fmt.Sprint(i)))
+		assert.True(t, found)
+		assert.Equal(t, 99, value)
+	}
+}
+
+func Test_Concurrent_SubscribeWhileSetting(t *testing.T) {
+	state := DefaultState()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("sub%d", i)
+			state.Subscribe(NewSubscription(name).With(Name).Calls(func(CallbackArgs) {}))
+			state.Unsubscribe(name)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			state.Set(Name, fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func Test_Concurrent_NotificationsDeliveredInOrder(t *testing.T) {
+	state := NewState()
+	var mu sync.Mutex
+	received := []int{}
+	callback := func(args CallbackArgs) {
+		v, _ := GetArg[int](args, Age)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, v)
+	}
+	state.Subscribe(NewSubscription("subName").With(Age).Calls(callback))
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			state.Set(Age, i)
+		}(i)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, received, 50)
+	value, _ := state.Get(Age)
+	assert.Equal(t, value, received[len(received)-1])
+}
+
+func Test_Concurrent_CallbackCanReadAndWrite(t *testing.T) {
+	state := DefaultState()
+	callback := func(args CallbackArgs) {
+		name, _ := state.Get(Name)
+		state.SetNested(Path{Job, Title}, name)
+	}
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(callback))
+	state.Set(Name, "Mike")
+	value, found := state.GetNested(Job, Title)
+	assert.True(t, found)
+	assert.Equal(t, "Mike", value)
+}
+
+func Test_Concurrent_CallbackArgsAreNotShared(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	var received CallbackArgs
+	state.Subscribe(NewSubscription("subName").With(Job).Calls(func(args CallbackArgs) { received = args }))
+	state.SetNested(Path{Job, Compensation}, 1000)
+	received[Job].(map[KeyString]interface{})[Title] = "Changed"
+	value, _ := state.GetNested(Job, Title)
+	assert.Equal(t, "Developer", value)
+}
+
+func Test_Concurrent_WritersDoNotWaitForOtherDeliveries(t *testing.T) {
+	state := DefaultState()
+	blocked, release := make(chan struct{}), make(chan struct{})
+	state.Subscribe(NewSubscription("slow").With(Age).Calls(func(CallbackArgs) {
+		close(blocked)
+		<-release
+	}))
+	var mu sync.Mutex
+	names := []interface{}{}
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(args CallbackArgs) {
+		mu.Lock()
+		defer mu.Unlock()
+		names = append(names, args[Name])
+	}))
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		state.Set(Age, 31)
+	}()
+	<-blocked
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < 20; i++ {
+			state.Set(Name, fmt.Sprint(i))
+		}
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer waited for another delivery")
+	}
+	close(release)
+	<-delivered
+	state.Flush()
+	expected := []interface{}{}
+	for i := 0; i < 20; i++ {
+		expected = append(expected, fmt.Sprint(i))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, expected, names)
+}
+
+func Test_Concurrent_CallbackWaitsForWriter(t *testing.T) {
+	state := DefaultState()
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state.Set(Age, 31)
+		}()
+		wg.Wait()
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		state.Set(Name, "Mike")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	age, _ := state.Get(Age)
+	assert.Equal(t, 31, age)
+}
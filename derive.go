@@ -0,0 +1,171 @@
+package transfig
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrDerivedCycle is returned by State.Derive when a derived value would
+// depend, directly or through other derived values, on itself.
+var ErrDerivedCycle = errors.New("cycle in derived values")
+
+// DeriveFunc computes a derived value from the values of its dependencies
+type DeriveFunc func(CallbackArgs) interface{}
+
+// derived is a value stored in the state that is computed from other values
+type derived struct {
+	path Path
+	deps []Selector
+	fn   DeriveFunc
+}
+
+// dependsOn returns true if a change to `path` may change the derived value
+func (d *derived) dependsOn(path Path) bool {
+	for _, dep := range d.deps {
+		if dep.Contains(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// compute calls the derive function with the values of the dependencies. A
+// panic in it is recovered and returned as a PanicError.
+func (d *derived) compute(values *pmap) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("can't derive %s: %w", pathString(d.path), &PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	sub := Subscription{selectors: d.deps}
+	return d.fn(sub.args(values)), nil
+}
+
+// Derive stores at `path` a value computed by `fn` from the values selected
+// by `deps`. The value is computed right away, and then recomputed only when
+// one of its dependencies changes, as part of the same change. It can be read
+// and subscribed to like any other value, and it may itself be a dependency
+// of other derived values. Values set directly at `path` are overwritten on
+// the next recomputation.
+//
+// `fn` is called while the state is locked, so it must not call any method of
+// the State. If it panics, or if the derived value does not match the schema,
+// the change that led to the recomputation is rejected with the error, which
+// wraps a PanicError for panics. Deriving a value at a path that already has
+// one replaces it. Returns an error wrapping ErrDerivedCycle if the derived
+// values would depend on themselves, or the error of the first computation,
+// in which case the derived value is not added.
+func (s *State) Derive(path Path, deps []Selector, fn DeriveFunc) error {
+	if len(path) == 0 {
+		return errors.New("can't derive a value at an empty path")
+	}
+	d := &derived{path: append(Path{}, path...), deps: deps, fn: fn}
+	s.mu.Lock()
+	err := s.derive(d)
+	s.mu.Unlock()
+	s.deliver()
+	return err
+}
+
+// derive implements Derive. Must be called with the write lock held.
+func (s *State) derive(d *derived) error {
+	all := []*derived{}
+	for _, other := range s.derived {
+		if !other.path.equal(d.path) {
+			all = append(all, other)
+		}
+	}
+	sorted, err := sortDerived(append(all, d))
+	if err != nil {
+		return err
+	}
+	previous := s.derived
+	s.derived = sorted
+	value, err := d.compute(s.values)
+	if err != nil {
+		s.derived = previous
+		return err
+	}
+	changes, err := s.mutate([]mutation{{op: OpSet, path: d.path, value: value}}, nil)
+	if err != nil {
+		s.derived = previous
+		return err
+	}
+	s.logAction(changes, "")
+	return nil
+}
+
+// recompute recomputes in `values` the derived values affected by `changes`
+// and returns the new values and `changes` followed by the changes to the
+// derived values, or the error of a derive function. Must be called with the
+// write lock held.
+func (s *State) recompute(values *pmap, changes []applied) (*pmap, []applied, error) {
+	for _, d := range s.derived {
+		for _, c := range changes {
+			if d.dependsOn(c.Path) {
+				value, err := d.compute(values)
+				if err != nil {
+					return nil, nil, err
+				}
+				m := mutation{op: OpSet, path: d.path, value: value}
+				var a applied
+				var changed bool
+				if values, a, changed = m.apply(values); changed {
+					changes = append(changes, a)
+				}
+				break
+			}
+		}
+	}
+	return values, changes, nil
+}
+
+// derivedPaths returns `paths` followed by the paths of all the derived values
+// that may change when `paths` change.
+func (s *State) derivedPaths(paths []Path) []Path {
+	for _, d := range s.derived {
+		for _, path := range paths {
+			if d.dependsOn(path) {
+				paths = append(paths, d.path)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// sortDerived sorts derived values so that every one comes after the derived
+// values it depends on.
+func sortDerived(all []*derived) ([]*derived, error) {
+	sorted := make([]*derived, 0, len(all))
+	// 0: not visited, 1: being visited, 2: done
+	state := make(map[*derived]int)
+	var visit func(d *derived, chain []Path) error
+	visit = func(d *derived, chain []Path) error {
+		chain = append(chain, d.path)
+		switch state[d] {
+		case 1:
+			return fmt.Errorf("%w: %v", ErrDerivedCycle, chain)
+		case 2:
+			return nil
+		}
+		state[d] = 1
+		for _, dep := range all {
+			if d.dependsOn(dep.path) {
+				if err := visit(dep, chain); err != nil {
+					return err
+				}
+			}
+		}
+		state[d] = 2
+		sorted = append(sorted, d)
+		return nil
+	}
+	for _, d := range all {
+		if err := visit(d, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
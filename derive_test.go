@@ -0,0 +1,157 @@
+package transfig_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+var Greeting = KeyString("greeting")
+
+func greet(args CallbackArgs) interface{} {
+	name, _ := GetArg[string](args, Name)
+	return "Hello " + name
+}
+
+func Test_Derive_ComputesRightAway(t *testing.T) {
+	state := DefaultState()
+	err := state.Derive(Path{Greeting}, []Selector{Name}, greet)
+	assert.NoError(t, err)
+	value, _ := state.Get(Greeting)
+	assert.Equal(t, "Hello John", value)
+}
+
+func Test_Derive_RecomputesOnDependencyChange(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	_ = state.Derive(Path{Greeting}, []Selector{Name}, func(args CallbackArgs) interface{} {
+		callCount++
+		return greet(args)
+	})
+	state.Set(Name, "Mike")
+	state.Set(Age, 40)
+	value, _ := state.Get(Greeting)
+	assert.Equal(t, "Hello Mike", value)
+	assert.Equal(t, 2, callCount)
+}
+
+func Test_Derive_Subscribable(t *testing.T) {
+	state := DefaultState()
+	_ = state.Derive(Path{Greeting}, []Selector{Name}, greet)
+	var event ChangeEvent
+	events := 0
+	sub := NewSubscription("subName").With(Greeting).CallsWithEvent(func(e ChangeEvent) {
+		events++
+		event = e
+	})
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	assert.Equal(t, 1, events)
+	assert.Equal(t, "Hello John", event.OldValue)
+	assert.Equal(t, "Hello Mike", event.NewValue)
+	assert.Equal(t, CallbackArgs{Greeting: "Hello Mike"}, event.Args)
+}
+
+func Test_Derive_NotNotifiedIfValueDidNotChange(t *testing.T) {
+	state := DefaultState()
+	_ = state.Derive(Path{Job, Title}, []Selector{Age}, func(args CallbackArgs) interface{} {
+		age, _ := GetArg[int](args, Age)
+		if age >= 18 {
+			return "Developer"
+		}
+		return "Student"
+	})
+	callCount := 0
+	state.Subscribe(NewSubscription("subName").WithNested(Job, Title).Calls(func(CallbackArgs) { callCount++ }))
+	state.Set(Age, 40)
+	assert.Equal(t, 0, callCount)
+	state.Set(Age, 10)
+	assert.Equal(t, 1, callCount)
+}
+
+func Test_Derive_Chained(t *testing.T) {
+	state := DefaultState()
+	Shout := KeyString("shout")
+	err := state.Derive(Path{Shout}, []Selector{Greeting}, func(args CallbackArgs) interface{} {
+		greeting, _ := GetArg[string](args, Greeting)
+		return greeting + "!"
+	})
+	assert.NoError(t, err)
+	err = state.Derive(Path{Greeting}, []Selector{Name}, greet)
+	assert.NoError(t, err)
+	state.Set(Name, "Mike")
+	value, _ := state.Get(Shout)
+	assert.Equal(t, "Hello Mike!", value)
+}
+
+func Test_Derive_Cycle(t *testing.T) {
+	state := DefaultState()
+	Other := KeyString("other")
+	identity := func(key KeyString) DeriveFunc {
+		return func(args CallbackArgs) interface{} { return fmt.Sprint(args[key]) }
+	}
+	assert.NoError(t, state.Derive(Path{Greeting}, []Selector{Other}, identity(Other)))
+	err := state.Derive(Path{Other}, []Selector{Greeting}, identity(Greeting))
+	assert.ErrorIs(t, err, ErrDerivedCycle)
+	_, found := state.Get(Other)
+	assert.False(t, found)
+}
+
+func Test_Derive_SelfCycle(t *testing.T) {
+	state := DefaultState()
+	err := state.Derive(Path{Job, Title}, []Selector{Job}, func(CallbackArgs) interface{} { return "" })
+	assert.ErrorIs(t, err, ErrDerivedCycle)
+}
+
+func Test_Derive_PanicIsReturned(t *testing.T) {
+	state := DefaultState()
+	err := state.Derive(Path{Greeting}, []Selector{Name}, func(args CallbackArgs) interface{} {
+		if name, _ := GetArg[string](args, Name); name == "Mike" {
+			panic("no Mikes")
+		}
+		return greet(args)
+	})
+	assert.NoError(t, err)
+	var panicErr *PanicError
+	assert.ErrorAs(t, state.TrySet(Name, "Mike"), &panicErr)
+	assert.Equal(t, "no Mikes", panicErr.Value)
+	name, _ := state.Get(Name)
+	assert.Equal(t, "John", name)
+	state.Set(Name, "Anna")
+	value, _ := state.Get(Greeting)
+	assert.Equal(t, "Hello Anna", value)
+}
+
+func Test_Derive_PanicOnFirstComputation(t *testing.T) {
+	state := DefaultState()
+	err := state.Derive(Path{Greeting}, []Selector{Name}, func(CallbackArgs) interface{} { panic("boom") })
+	var panicErr *PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	_, found := state.Get(Greeting)
+	assert.False(t, found)
+	state.Set(Name, "Mike")
+	name, _ := state.Get(Name)
+	assert.Equal(t, "Mike", name)
+}
+
+func Test_Derive_ValidatedAgainstSchema(t *testing.T) {
+	state, err := NewStateFromMapWithSchema(map[KeyString]interface{}{Name: "John"}, Schema{
+		Name:     {Type: reflect.TypeOf("")},
+		Greeting: {Type: reflect.TypeOf(""), Enum: []interface{}{"Hello John", "Hello Mike"}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, state.Derive(Path{Greeting}, []Selector{Name}, greet))
+	var validationErr *ValidationError
+	assert.ErrorAs(t, state.TrySet(Name, "Anna"), &validationErr)
+	assert.Equal(t, Path{Greeting}, validationErr.Path)
+	name, _ := state.Get(Name)
+	assert.Equal(t, "John", name)
+
+	err = state.Derive(Path{Greeting}, []Selector{Name}, func(CallbackArgs) interface{} { return 1 })
+	assert.ErrorAs(t, err, &validationErr)
+	value, _ := state.Get(Greeting)
+	assert.Equal(t, "Hello John", value)
+}
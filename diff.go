@@ -0,0 +1,88 @@
+package transfig
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Diff returns the changes that turn `a` into `b`. Maps found in both are
+// compared key by key, so that the changes are as deep as possible. Changes
+// are sorted by path.
+func Diff(a, b CallbackArgs) []Change {
+	return mapDiff(Path{}, a, b)
+}
+
+func mapDiff(path Path, a, b map[KeyString]interface{}) []Change {
+	keys := make([]KeyString, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, found := a[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	changes := []Change{}
+	for _, key := range keys {
+		keyPath := append(append(Path{}, path...), key)
+		oldValue, existed := a[key]
+		newValue, found := b[key]
+		if !found {
+			changes = append(changes, Change{Op: OpClear, Path: keyPath, OldValue: oldValue, Existed: true})
+			continue
+		}
+		oldAsMap, oldIsMap := oldValue.(map[KeyString]interface{})
+		newAsMap, newIsMap := newValue.(map[KeyString]interface{})
+		if existed && oldIsMap && newIsMap {
+			changes = append(changes, mapDiff(keyPath, oldAsMap, newAsMap)...)
+			continue
+		}
+		if !existed || !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, Change{Op: OpSet, Path: keyPath, OldValue: oldValue, NewValue: newValue, Existed: existed})
+		}
+	}
+	return changes
+}
+
+// pmapDiff is mapDiff for pmaps. The nodes shared by `a` and `b` are skipped,
+// so the changes between two versions of the state values are found in
+// proportion to what changed between them, not to their size.
+func pmapDiff(path Path, a, b *pmap) []Change {
+	changes := []Change{}
+	for _, key := range a.diffKeys(b) {
+		keyPath := append(append(Path{}, path...), key)
+		oldValue, existed := a.get(key)
+		newValue, found := b.get(key)
+		if !found {
+			if existed {
+				changes = append(changes, Change{Op: OpClear, Path: keyPath, OldValue: oldValue, Existed: true})
+			}
+			continue
+		}
+		oldAsPmap, oldIsPmap := oldValue.(*pmap)
+		newAsPmap, newIsPmap := newValue.(*pmap)
+		if existed && oldIsPmap && newIsPmap {
+			changes = append(changes, pmapDiff(keyPath, oldAsPmap, newAsPmap)...)
+			continue
+		}
+		if !existed || !valueEqual(oldValue, newValue) {
+			changes = append(changes, Change{Op: OpSet, Path: keyPath, OldValue: oldValue, NewValue: newValue, Existed: existed})
+		}
+	}
+	return changes
+}
+
+// Apply applies the changes atomically, as a single Batch. Only the Op, Path
+// and NewValue of each change are used.
+func (s *State) Apply(changes []Change) error {
+	return s.commit(changeMutations(changes))
+}
+
+func changeMutations(changes []Change) []mutation {
+	mutations := make([]mutation, 0, len(changes))
+	for _, c := range changes {
+		mutations = append(mutations, c.mutation())
+	}
+	return mutations
+}
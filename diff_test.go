@@ -0,0 +1,62 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_Diff(t *testing.T) {
+	a := CallbackArgs{
+		Name: "John",
+		Age:  30,
+		Job:  map[KeyString]interface{}{Title: "Developer", Compensation: 1000},
+	}
+	b := CallbackArgs{
+		Name: "John",
+		Job:  map[KeyString]interface{}{Title: "Manager", Ammount: 1},
+	}
+	assert.Equal(t, []Change{
+		{Op: OpClear, Path: Path{Age}, OldValue: 30, Existed: true},
+		{Op: OpSet, Path: Path{Job, Ammount}, NewValue: 1},
+		{Op: OpClear, Path: Path{Job, Compensation}, OldValue: 1000, Existed: true},
+		{Op: OpSet, Path: Path{Job, Title}, OldValue: "Developer", NewValue: "Manager", Existed: true},
+	}, Diff(a, b))
+}
+
+func Test_Diff_MapAndNonMap(t *testing.T) {
+	a := CallbackArgs{Job: "Developer"}
+	b := CallbackArgs{Job: map[KeyString]interface{}{Title: "Developer"}}
+	assert.Equal(t, []Change{
+		{Op: OpSet, Path: Path{Job}, OldValue: "Developer", NewValue: b[Job], Existed: true},
+	}, Diff(a, b))
+	assert.Empty(t, Diff(a, a))
+}
+
+func Test_Apply(t *testing.T) {
+	a := DefaultState()
+	b := DefaultState()
+	b.Set(Name, "Mike")
+	b.SetNested(Path{Job, Title}, "Developer")
+	b.ClearNested(Path{Age})
+	callCount := 0
+	a.Subscribe(NewSubscription("subName").With(Wildcard{}).Calls(func(CallbackArgs) { callCount++ }))
+
+	err := a.Apply(Diff(a.AsMap(), b.AsMap()))
+
+	assert.NoError(t, err)
+	assert.Equal(t, b.AsMap(), a.AsMap())
+	assert.Equal(t, 1, callCount)
+}
+
+func Test_Apply_Rejected(t *testing.T) {
+	state := DefaultState()
+	state.Use(rejectAge)
+	err := state.Apply([]Change{
+		{Op: OpSet, Path: Path{Name}, NewValue: "Mike"},
+		{Op: OpClear, Path: Path{Age}},
+	})
+	assert.ErrorIs(t, err, errRejected)
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
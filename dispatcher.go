@@ -0,0 +1,214 @@
+package transfig
+
+import (
+	"context"
+	"sync"
+)
+
+// Dispatcher delivers the notifications of a State to its subscriptions
+type Dispatcher interface {
+	// Dispatch delivers a notification to `sub` by calling `deliver`, either
+	// right away or later, from any goroutine. Notifications to the same
+	// subscription must be delivered in the order they are dispatched.
+	Dispatch(sub *Subscription, deliver func())
+	// Wait blocks until all the notifications dispatched so far, and the
+	// ones dispatched while delivering them, have been delivered, or until
+	// `ctx` is done, in which case it returns its error.
+	Wait(ctx context.Context) error
+}
+
+// SyncDispatcher delivers notifications right away, in the goroutine that
+// dispatches them. It is the default dispatcher of a State.
+type SyncDispatcher struct{}
+
+func (SyncDispatcher) Dispatch(_ *Subscription, deliver func()) { deliver() }
+
+func (SyncDispatcher) Wait(context.Context) error { return nil }
+
+// AsyncDispatcher delivers notifications in the background, using a fixed
+// number of worker goroutines, so that slow callbacks don't block the
+// goroutines changing the state. All the notifications to a subscription are
+// delivered by the same worker (subscriptions are spread over the workers
+// regardless of their names), so they are delivered in order, and a slow
+// subscription only delays the ones sharing its worker. Notifications to
+// different subscriptions may be delivered in any order. Dispatching never
+// blocks: notifications wait in an unbounded queue for their worker.
+type AsyncDispatcher struct {
+	workers []*dispatchWorker
+	mu      sync.Mutex
+	pending int
+	idle    chan struct{}
+}
+
+// NewAsyncDispatcher creates a dispatcher with `workers` workers, or one if
+// `workers` is less than one. The dispatcher must be closed when no longer
+// used.
+func NewAsyncDispatcher(workers int) *AsyncDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &AsyncDispatcher{workers: make([]*dispatchWorker, workers)}
+	for i := range d.workers {
+		w := &dispatchWorker{}
+		w.cond = sync.NewCond(&w.mu)
+		d.workers[i] = w
+		go w.run(d.done)
+	}
+	return d
+}
+
+// Dispatch queues a notification for the worker of `sub`. If the dispatcher
+// is closed, the notification is delivered right away instead.
+func (d *AsyncDispatcher) Dispatch(sub *Subscription, deliver func()) {
+	d.mu.Lock()
+	if d.pending == 0 {
+		d.idle = make(chan struct{})
+	}
+	d.pending++
+	d.mu.Unlock()
+	if !d.workers[sub.serial%uint64(len(d.workers))].push(deliver) {
+		deliver()
+		d.done()
+	}
+}
+
+// Wait implements Dispatcher
+func (d *AsyncDispatcher) Wait(ctx context.Context) error {
+	d.mu.Lock()
+	if d.pending == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	idle := d.idle
+	d.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the workers once they have delivered all queued notifications.
+// Notifications dispatched after Close are delivered right away.
+func (d *AsyncDispatcher) Close() {
+	for _, w := range d.workers {
+		w.close()
+	}
+}
+
+// done marks a dispatched notification as delivered
+func (d *AsyncDispatcher) done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending--
+	if d.pending == 0 {
+		close(d.idle)
+	}
+}
+
+// dispatchWorker delivers queued notifications, in order, in its own goroutine
+type dispatchWorker struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []func()
+	closed bool
+}
+
+// push queues a notification and returns true, or returns false if the
+// worker is closed
+func (w *dispatchWorker) push(deliver func()) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	w.queue = append(w.queue, deliver)
+	w.cond.Signal()
+	return true
+}
+
+func (w *dispatchWorker) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.cond.Signal()
+}
+
+// run delivers queued notifications until the worker is closed and its queue
+// is empty, calling `done` after each one
+func (w *dispatchWorker) run(done func()) {
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		deliver := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+		deliver()
+		done()
+	}
+}
+
+// SetDispatcher sets the dispatcher used to deliver the notifications of the
+// state. A nil dispatcher is the same as SyncDispatcher.
+func (s *State) SetDispatcher(d Dispatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatcher = d
+}
+
+// dispatcherOf returns the dispatcher of the state. Must be called with the
+// lock held.
+func (s *State) dispatcherOf() Dispatcher {
+	if s.dispatcher == nil {
+		return SyncDispatcher{}
+	}
+	return s.dispatcher
+}
+
+// WaitIdle blocks until all the notifications queued so far, and the ones
+// queued while delivering them, have been delivered, or until `ctx` is done,
+// in which case it returns its error.
+func (s *State) WaitIdle(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.delivering {
+			delivered := s.delivered
+			s.mu.Unlock()
+			select {
+			case <-delivered:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if len(s.pending) > 0 {
+			s.mu.Unlock()
+			s.deliver()
+			continue
+		}
+		d := s.dispatcherOf()
+		s.mu.Unlock()
+		if err := d.Wait(ctx); err != nil {
+			return err
+		}
+		s.mu.RLock()
+		idle := !s.delivering && len(s.pending) == 0
+		s.mu.RUnlock()
+		if idle {
+			return nil
+		}
+	}
+}
+
+// Flush blocks until all the notifications queued so far have been
+// delivered, as in WaitIdle.
+func (s *State) Flush() {
+	_ = s.WaitIdle(context.Background())
+}
@@ -0,0 +1,127 @@
+package transfig_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_AsyncDispatcher_DoesNotBlockWriters(t *testing.T) {
+	state := DefaultState()
+	dispatcher := NewAsyncDispatcher(2)
+	defer dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	names := []interface{}{}
+	state.Subscribe(NewSubscription("slow").With(Name).Calls(func(args CallbackArgs) {
+		<-release
+		mu.Lock()
+		names = append(names, args[Name])
+		mu.Unlock()
+	}))
+	state.Set(Name, "Mike")
+	state.Set(Name, "Paul")
+	name, _ := state.Get(Name)
+	assert.Equal(t, "Paul", name)
+	close(release)
+	state.Flush()
+	assert.Equal(t, []interface{}{"Mike", "Paul"}, names)
+}
+
+func Test_AsyncDispatcher_SameNameDifferentWorkers(t *testing.T) {
+	state := DefaultState()
+	dispatcher := NewAsyncDispatcher(2)
+	defer dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	release := make(chan struct{})
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { <-release }))
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { close(release) }))
+	state.Set(Name, "Mike")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, state.WaitIdle(ctx))
+}
+
+func Test_AsyncDispatcher_PreservesOrderPerSubscription(t *testing.T) {
+	state := DefaultState()
+	dispatcher := NewAsyncDispatcher(4)
+	defer dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	var mu sync.Mutex
+	received := map[string][]interface{}{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprint("sub", i)
+		state.Subscribe(NewSubscription(name).With(Age).Calls(func(args CallbackArgs) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name] = append(received[name], args[Age])
+		}))
+	}
+	expected := []interface{}{}
+	for i := 0; i < 100; i++ {
+		state.Set(Age, i)
+		expected = append(expected, i)
+	}
+	assert.NoError(t, state.WaitIdle(context.Background()))
+	assert.Len(t, received, 10)
+	for name, ages := range received {
+		assert.Equal(t, expected, ages, name)
+	}
+}
+
+func Test_AsyncDispatcher_WaitsForCascades(t *testing.T) {
+	state := DefaultState()
+	dispatcher := NewAsyncDispatcher(2)
+	defer dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	state.Subscribe(NewSubscription("copyName").With(Name).Calls(func(args CallbackArgs) {
+		time.Sleep(10 * time.Millisecond)
+		state.Set(Title, args[Name])
+	}))
+	state.Set(Name, "Mike")
+	state.Flush()
+	title, _ := state.Get(Title)
+	assert.Equal(t, "Mike", title)
+}
+
+func Test_WaitIdle_ContextDone(t *testing.T) {
+	state := DefaultState()
+	dispatcher := NewAsyncDispatcher(1)
+	defer dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	release := make(chan struct{})
+	state.Subscribe(NewSubscription("slow").With(Name).Calls(func(CallbackArgs) { <-release }))
+	state.Set(Name, "Mike")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, state.WaitIdle(ctx), context.DeadlineExceeded)
+	close(release)
+	assert.NoError(t, state.WaitIdle(context.Background()))
+}
+
+func Test_AsyncDispatcher_Closed(t *testing.T) {
+	state := DefaultState()
+	dispatcher := NewAsyncDispatcher(1)
+	dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	calls := 0
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { calls++ }))
+	state.Set(Name, "Mike")
+	assert.Equal(t, 1, calls)
+}
+
+func Test_SyncDispatcher(t *testing.T) {
+	state := DefaultState()
+	state.SetDispatcher(SyncDispatcher{})
+	calls := 0
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { calls++ }))
+	state.Set(Name, "Mike")
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, state.WaitIdle(context.Background()))
+}
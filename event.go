@@ -0,0 +1,54 @@
+package transfig
+
+// ChangeEvent is passed to event callbacks when the state changes. The
+// embedded Change is the last change relevant to the subscription, and
+// Changes holds all of them, in the order they were made. There is more than
+// one only when the changes were made by a Batch.
+type ChangeEvent struct {
+	Change
+	// Seq is the sequence number of the commit (a Set, a ClearNested, a
+	// Batch...) that produced the event. It increases by one on every
+	// commit, and all events produced by the same commit share it.
+	Seq     uint64
+	Changes []Change
+	// Args are the subscribed values, as in SubscriptionCallback.
+	Args CallbackArgs
+	// Snapshot holds all the state values right after the commit. Unlike
+	// Args, it is not copied for every event.
+	Snapshot Snapshot
+}
+
+// EventCallback is a subscription callback that receives a ChangeEvent
+type EventCallback func(ChangeEvent)
+
+// CallsWithEvent adds a function to be called with a ChangeEvent when the
+// state changes
+func (s *Subscription) CallsWithEvent(callback EventCallback) *Subscription {
+	s.callbacks = append(s.callbacks, func(event ChangeEvent) error {
+		callback(event)
+		return nil
+	})
+	return s
+}
+
+// event builds the event for the subscription from the changes made by a
+// commit. The boolean is false if the subscription is not subscribed to any
+// of the changes.
+func (s *Subscription) event(seq uint64, changes []applied, values *pmap) (ChangeEvent, bool) {
+	relevant := []Change{}
+	for _, c := range changes {
+		if s.subscribedTo(c.Path) {
+			relevant = append(relevant, c.Change.copy())
+		}
+	}
+	if len(relevant) == 0 {
+		return ChangeEvent{}, false
+	}
+	return ChangeEvent{
+		Change:   relevant[len(relevant)-1],
+		Seq:      seq,
+		Changes:  relevant,
+		Args:     s.args(values),
+		Snapshot: Snapshot{values: values, seq: seq},
+	}, true
+}
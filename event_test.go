@@ -0,0 +1,86 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_CallsWithEvent_Set(t *testing.T) {
+	state := DefaultState()
+	var event ChangeEvent
+	sub := NewSubscription("subName").With(Name).CallsWithEvent(func(e ChangeEvent) { event = e })
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	assert.Equal(t, OpSet, event.Op)
+	assert.Equal(t, Path{Name}, event.Path)
+	assert.Equal(t, "John", event.OldValue)
+	assert.Equal(t, "Mike", event.NewValue)
+	assert.True(t, event.Existed)
+	assert.Equal(t, CallbackArgs{Name: "Mike"}, event.Args)
+	assert.Len(t, event.Changes, 1)
+}
+
+func Test_CallsWithEvent_SetNew(t *testing.T) {
+	state := DefaultState()
+	var event ChangeEvent
+	sub := NewSubscription("subName").With(Job).CallsWithEvent(func(e ChangeEvent) { event = e })
+	state.Subscribe(sub)
+	state.SetNested(Path{Job, Title}, "Developer")
+	assert.Equal(t, Path{Job, Title}, event.Path)
+	assert.False(t, event.Existed)
+	assert.Nil(t, event.OldValue)
+	assert.Equal(t, "Developer", event.NewValue)
+}
+
+func Test_CallsWithEvent_Clear(t *testing.T) {
+	state := DefaultState()
+	var event ChangeEvent
+	sub := NewSubscription("subName").With(Age).CallsWithEvent(func(e ChangeEvent) { event = e })
+	state.Subscribe(sub)
+	state.ClearNested(Path{Age})
+	assert.Equal(t, OpClear, event.Op)
+	assert.Equal(t, 30, event.OldValue)
+	assert.Nil(t, event.NewValue)
+}
+
+func Test_CallsWithEvent_SeqIncreases(t *testing.T) {
+	state := DefaultState()
+	seqs := []uint64{}
+	sub := NewSubscription("subName").With(Wildcard{}).CallsWithEvent(func(e ChangeEvent) { seqs = append(seqs, e.Seq) })
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	state.Set(Name, "Paul")
+	assert.Len(t, seqs, 2)
+	assert.Equal(t, seqs[0]+1, seqs[1])
+}
+
+func Test_CallsWithEvent_BatchOnlyRelevantChanges(t *testing.T) {
+	state := DefaultState()
+	events := []ChangeEvent{}
+	sub := NewSubscription("subName").With(Job).CallsWithEvent(func(e ChangeEvent) { events = append(events, e) })
+	state.Subscribe(sub)
+	_ = state.Batch(func(tx *Tx) error {
+		tx.SetNested(Path{Job, Title}, "Developer")
+		tx.Set(Name, "Mike")
+		tx.SetNested(Path{Job, Compensation}, 1000)
+		return nil
+	})
+	assert.Len(t, events, 1)
+	assert.Len(t, events[0].Changes, 2)
+	assert.Equal(t, Path{Job, Title}, events[0].Changes[0].Path)
+	assert.Equal(t, Path{Job, Compensation}, events[0].Path)
+}
+
+func Test_CallsWithEvent_MixedWithCalls(t *testing.T) {
+	state := DefaultState()
+	calls := []string{}
+	sub := NewSubscription("subName").
+		With(Name).
+		Calls(func(CallbackArgs) { calls = append(calls, "args") }).
+		CallsWithEvent(func(ChangeEvent) { calls = append(calls, "event") })
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	assert.Equal(t, []string{"args", "event"}, calls)
+}
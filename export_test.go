@@ -3,3 +3,11 @@ package transfig
 var MapDeepCopy = mapDeepCopy
 var MapSetNested = mapSetNested
 var MapGetNested = mapGetNested
+var MapMerge = mapMerge
+var NewPmap = newPmap
+var PmapGetNested = pmapGetNested
+var PmapWithNested = pmapWithNested
+var PmapWithoutNested = pmapWithoutNested
+
+func PmapToMap(p *pmap) map[KeyString]interface{} { return p.toMap() }
+func PmapLen(p *pmap) int                         { return p.len() }
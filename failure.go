@@ -0,0 +1,129 @@
+package transfig
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// ErrSubscriptionDisabled is reported when a subscription is removed from a
+// State because its callbacks failed too many times in a row
+var ErrSubscriptionDisabled = errors.New("subscription disabled")
+
+// ErrorCallback is a subscription callback that can fail
+type ErrorCallback func(CallbackArgs) error
+
+// EventErrorCallback is an event callback that can fail
+type EventErrorCallback func(ChangeEvent) error
+
+// PanicError is reported when a callback panics, and returned when a
+// DeriveFunc does
+type PanicError struct {
+	// Value is the value the callback panicked with
+	Value interface{}
+	// Stack is the stack trace of the goroutine when it panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// CallsE adds a function to be called when the state changes. Errors it
+// returns are reported to the State's error handler (see State.OnError).
+func (s *Subscription) CallsE(callback ErrorCallback) *Subscription {
+	s.callbacks = append(s.callbacks, func(event ChangeEvent) error { return callback(event.Args) })
+	return s
+}
+
+// CallsWithEventE adds a function to be called with a ChangeEvent when the
+// state changes. Errors it returns are reported to the State's error handler
+// (see State.OnError).
+func (s *Subscription) CallsWithEventE(callback EventErrorCallback) *Subscription {
+	s.callbacks = append(s.callbacks, callback)
+	return s
+}
+
+// DisableAfter makes the State remove the subscription once its callbacks
+// fail (return an error or panic) on `failures` notifications in a row. An
+// error wrapping ErrSubscriptionDisabled is then reported. Zero, the default,
+// never removes it.
+func (s *Subscription) DisableAfter(failures int) *Subscription {
+	s.maxFailures = failures
+	return s
+}
+
+// call calls a callback, recovering a panic as a PanicError
+func call(callback EventErrorCallback, event ChangeEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return callback(event)
+}
+
+// OnError sets the function called with the errors returned by callbacks,
+// with the panics in them, and with the errors of the mutations they made
+// (see State), along with the name of their subscription. A failing callback
+// doesn't stop the other callbacks or subscriptions from being notified.
+// Without a handler, errors are written to the standard logger.
+func (s *State) OnError(handler func(subName string, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = handler
+}
+
+// notify delivers a notification and reports the errors of its callbacks,
+// disabling the subscription if they failed too many times in a row.
+// Notifications to subscriptions that were removed after they were queued
+// are dropped.
+func (s *State) notify(n notification) {
+	s.mu.RLock()
+	reg, found := s.subscriptions[n.sub]
+	s.mu.RUnlock()
+	if !found {
+		return
+	}
+	errs := n.sub.notify(n.event)
+	s.mu.Lock()
+	handler := s.onError
+	reg.notified++
+	if len(errs) == 0 {
+		reg.failures = 0
+	} else {
+		reg.failures++
+	}
+	failures := reg.failures
+	disabled := n.sub.maxFailures > 0 && failures >= n.sub.maxFailures && s.subscriptions[n.sub] == reg
+	if disabled {
+		s.remove(n.sub)
+	}
+	s.mu.Unlock()
+	if disabled {
+		errs = append(errs, fmt.Errorf("%w after %d failures in a row", ErrSubscriptionDisabled, failures))
+	}
+	for _, err := range errs {
+		reportTo(handler, n.sub.name, err)
+	}
+}
+
+// report reports the error of a subscription to the OnError handler, if
+// any. Must be called without the lock held.
+func (s *State) report(subName string, err error) {
+	s.mu.RLock()
+	handler := s.onError
+	s.mu.RUnlock()
+	reportTo(handler, subName, err)
+}
+
+// reportTo calls `handler` with the error of a subscription, or writes it to
+// the standard logger if `handler` is nil
+func reportTo(handler func(subName string, err error), subName string, err error) {
+	if handler != nil {
+		handler(subName, err)
+	} else {
+		log.Printf("transfig: subscription %q: %v", subName, err)
+	}
+}
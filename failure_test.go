@@ -0,0 +1,96 @@
+package transfig_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+// failure is an error reported to an OnError handler
+type failure struct {
+	subName string
+	err     error
+}
+
+// recordFailures makes the state record the errors reported by callbacks
+func recordFailures(state *State) *[]failure {
+	failures := &[]failure{}
+	state.OnError(func(subName string, err error) {
+		*failures = append(*failures, failure{subName, err})
+	})
+	return failures
+}
+
+func Test_OnError_PanicIsolated(t *testing.T) {
+	state := DefaultState()
+	failures := recordFailures(state)
+	calls := 0
+	state.Subscribe(NewSubscription("panics").With(Name).Calls(func(CallbackArgs) { panic("boom") }))
+	state.Subscribe(NewSubscription("works").With(Name).Calls(func(CallbackArgs) { calls++ }))
+	assert.NotPanics(t, func() { state.Set(Name, "Mike") })
+	assert.Equal(t, 1, calls)
+	assert.Len(t, *failures, 1)
+	assert.Equal(t, "panics", (*failures)[0].subName)
+	var panicErr *PanicError
+	assert.True(t, errors.As((*failures)[0].err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+	assert.Equal(t, "panic: boom", panicErr.Error())
+}
+
+func Test_OnError_ReturnedErrors(t *testing.T) {
+	state := DefaultState()
+	failures := recordFailures(state)
+	calls := 0
+	sub := NewSubscription("fails").With(Name).
+		CallsE(func(CallbackArgs) error { return errRejected }).
+		Calls(func(CallbackArgs) { calls++ }).
+		CallsWithEventE(func(event ChangeEvent) error { return errors.New(event.NewValue.(string)) })
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []failure{{"fails", errRejected}, {"fails", errors.New("Mike")}}, *failures)
+}
+
+func Test_OnError_DefaultLogs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(buf)
+	state := DefaultState()
+	state.Subscribe(NewSubscription("fails").With(Name).CallsE(func(CallbackArgs) error { return errRejected }))
+	state.Set(Name, "Mike")
+	assert.Contains(t, buf.String(), `subscription "fails": `+errRejected.Error())
+}
+
+func Test_DisableAfter(t *testing.T) {
+	state := DefaultState()
+	failures := recordFailures(state)
+	calls := 0
+	fail := true
+	sub := NewSubscription("flaky").With(Age).DisableAfter(2).CallsE(func(CallbackArgs) error {
+		calls++
+		if fail {
+			return errRejected
+		}
+		return nil
+	})
+	state.Subscribe(sub)
+	state.Set(Age, 1)
+	fail = false
+	state.Set(Age, 2)
+	fail = true
+	state.Set(Age, 3)
+	state.Set(Age, 4)
+	state.Set(Age, 5)
+	assert.Equal(t, 4, calls)
+	assert.Len(t, *failures, 4)
+	assert.ErrorIs(t, (*failures)[3].err, ErrSubscriptionDisabled)
+
+	state.Subscribe(sub)
+	state.Set(Age, 6)
+	assert.Equal(t, 5, calls)
+}
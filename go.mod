@@ -5,8 +5,9 @@ go 1.22.0
 require github.com/stretchr/testify v1.9.0
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/dave/jennifer v1.7.0
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
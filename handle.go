@@ -0,0 +1,191 @@
+package transfig
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrDuplicateSubscription is returned by State.SubscribeUnique when the
+// state already has a subscription with the same name
+var ErrDuplicateSubscription = errors.New("duplicate subscription name")
+
+// registration holds what a State knows about one of its subscriptions
+type registration struct {
+	// id orders the subscriptions by the time they were subscribed
+	id       uint64
+	notified uint64
+	failures int
+}
+
+// SubscriptionHandle identifies a subscription added to a State, so that it
+// can be removed without relying on its name
+type SubscriptionHandle struct {
+	state *State
+	sub   *Subscription
+	reg   *registration
+}
+
+// Cancel removes the subscription from the state. Notifications that were
+// queued but not delivered yet are dropped. Cancelling a subscription more
+// than once, or after it was removed in any other way, does nothing.
+func (h SubscriptionHandle) Cancel() {
+	if h.state == nil {
+		return
+	}
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+	if h.state.subscriptions[h.sub] == h.reg {
+		h.state.remove(h.sub)
+	}
+}
+
+// Active returns true if the subscription was not removed from the state
+func (h SubscriptionHandle) Active() bool {
+	if h.state == nil {
+		return false
+	}
+	h.state.mu.RLock()
+	defer h.state.mu.RUnlock()
+	return h.state.subscriptions[h.sub] == h.reg
+}
+
+// Subscription returns the subscription the handle refers to
+func (h SubscriptionHandle) Subscription() *Subscription {
+	return h.sub
+}
+
+// SubscriptionInfo describes a subscription of a State
+type SubscriptionInfo struct {
+	Name      string
+	Selectors []Selector
+	// Callbacks is the number of callbacks of the subscription
+	Callbacks int
+	// Notified is the number of notifications delivered to the subscription
+	Notified uint64
+	// Failures is the number of notifications in a row on which the
+	// subscription's callbacks failed
+	Failures int
+	Phase    Phase
+	Priority int
+}
+
+// Subscribe adds a subscription to the state and returns a handle to remove
+// it. The subscription's selectors must not be changed after it is
+// subscribed. Several subscriptions may have the same name, and all of them
+// are notified. Subscribing a subscription that is already subscribed
+// returns its existing handle.
+func (s *State) Subscribe(subscription *Subscription) SubscriptionHandle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(subscription)
+}
+
+// SubscribeUnique is Subscribe, except that it returns an error wrapping
+// ErrDuplicateSubscription if the state already has another subscription
+// with the same name
+func (s *State) SubscribeUnique(subscription *Subscription) (SubscriptionHandle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for other := range s.names[subscription.name] {
+		if other != subscription {
+			return SubscriptionHandle{}, fmt.Errorf("%w: %q", ErrDuplicateSubscription, subscription.name)
+		}
+	}
+	return s.add(subscription), nil
+}
+
+// Unsubscribe removes all the subscriptions named `subscriptionName` from the
+// state. Prefer SubscriptionHandle.Cancel, which only removes one.
+func (s *State) Unsubscribe(subscriptionName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.names[subscriptionName] {
+		s.remove(sub)
+	}
+}
+
+// Subscriptions describes the subscriptions of the state, in the order they
+// were subscribed
+func (s *State) Subscriptions() []SubscriptionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subs := make([]*Subscription, 0, len(s.subscriptions))
+	for sub := range s.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return s.subscriptions[subs[i]].id < s.subscriptions[subs[j]].id })
+	infos := make([]SubscriptionInfo, len(subs))
+	for i, sub := range subs {
+		reg := s.subscriptions[sub]
+		infos[i] = SubscriptionInfo{
+			Name:      sub.name,
+			Selectors: append([]Selector{}, sub.selectors...),
+			Callbacks: len(sub.callbacks),
+			Notified:  reg.notified,
+			Failures:  reg.failures,
+			Phase:     sub.phase,
+			Priority:  sub.priority,
+		}
+	}
+	return infos
+}
+
+// add adds a subscription to the state. Must be called with the write lock
+// held.
+func (s *State) add(sub *Subscription) SubscriptionHandle {
+	if reg, found := s.subscriptions[sub]; found {
+		return SubscriptionHandle{state: s, sub: sub, reg: reg}
+	}
+	s.nextID++
+	reg := &registration{id: s.nextID}
+	s.subscriptions[sub] = reg
+	if s.names[sub.name] == nil {
+		s.names[sub.name] = make(map[*Subscription]bool)
+	}
+	s.names[sub.name][sub] = true
+	s.index.add(sub)
+	sub.mu.Lock()
+	if sub.states == nil {
+		sub.states = make(map[*State]bool)
+	}
+	sub.states[s] = true
+	sub.mu.Unlock()
+	return SubscriptionHandle{state: s, sub: sub, reg: reg}
+}
+
+// remove removes a subscription from the state. Must be called with the write
+// lock held.
+func (s *State) remove(sub *Subscription) {
+	if _, found := s.subscriptions[sub]; !found {
+		return
+	}
+	delete(s.subscriptions, sub)
+	delete(s.names[sub.name], sub)
+	if len(s.names[sub.name]) == 0 {
+		delete(s.names, sub.name)
+	}
+	s.index.remove(sub)
+	sub.mu.Lock()
+	delete(sub.states, s)
+	sub.mu.Unlock()
+}
+
+// reindex indexes the subscription again by its current selectors in every
+// state it is subscribed to
+func (s *Subscription) reindex() {
+	s.mu.Lock()
+	states := make([]*State, 0, len(s.states))
+	for state := range s.states {
+		states = append(states, state)
+	}
+	s.mu.Unlock()
+	for _, state := range states {
+		state.mu.Lock()
+		if _, found := state.subscriptions[s]; found {
+			state.index.remove(s)
+			state.index.add(s)
+		}
+		state.mu.Unlock()
+	}
+}
@@ -0,0 +1,97 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_Subscribe_SameNameAllowed(t *testing.T) {
+	state := DefaultState()
+	calls := []string{}
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { calls = append(calls, "first") }))
+	state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { calls = append(calls, "second") }))
+	state.Set(Name, "Mike")
+	assert.ElementsMatch(t, []string{"first", "second"}, calls)
+}
+
+func Test_SubscribeUnique(t *testing.T) {
+	state := DefaultState()
+	sub := NewSubscription("subName").With(Name)
+	_, err := state.SubscribeUnique(sub)
+	assert.NoError(t, err)
+	_, err = state.SubscribeUnique(sub)
+	assert.NoError(t, err)
+	_, err = state.SubscribeUnique(NewSubscription("subName").With(Age))
+	assert.ErrorIs(t, err, ErrDuplicateSubscription)
+	assert.ErrorContains(t, err, "subName")
+	assert.Len(t, state.Subscriptions(), 1)
+}
+
+func Test_SubscriptionHandle_Cancel(t *testing.T) {
+	state := DefaultState()
+	calls := 0
+	handle := state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { calls++ }))
+	assert.True(t, handle.Active())
+	state.Set(Name, "Mike")
+	handle.Cancel()
+	handle.Cancel()
+	assert.False(t, handle.Active())
+	state.Set(Name, "Paul")
+	assert.Equal(t, 1, calls)
+
+	newHandle := state.Subscribe(handle.Subscription())
+	handle.Cancel()
+	assert.True(t, newHandle.Active())
+	state.Set(Name, "Anna")
+	assert.Equal(t, 2, calls)
+	SubscriptionHandle{}.Cancel()
+	assert.False(t, SubscriptionHandle{}.Active())
+}
+
+func Test_SubscriptionHandle_CancelDropsQueued(t *testing.T) {
+	state := DefaultState()
+	calls := 0
+	var second SubscriptionHandle
+	state.Subscribe(NewSubscription("first").With(Name).Calls(func(CallbackArgs) { second.Cancel() }))
+	second = state.Subscribe(NewSubscription("second").With(Name).Calls(func(CallbackArgs) { calls++ }))
+	state.Set(Name, "Mike")
+	assert.Equal(t, 0, calls)
+}
+
+func Test_Subscribe_Twice(t *testing.T) {
+	state := DefaultState()
+	calls := 0
+	sub := NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { calls++ })
+	first := state.Subscribe(sub)
+	second := state.Subscribe(sub)
+	assert.Equal(t, first, second)
+	state.Set(Name, "Mike")
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Unsubscribe_AllWithName(t *testing.T) {
+	state := DefaultState()
+	state.Subscribe(NewSubscription("subName").With(Name))
+	state.Subscribe(NewSubscription("subName").With(Age))
+	state.Subscribe(NewSubscription("other").With(Age))
+	state.Unsubscribe("subName")
+	infos := state.Subscriptions()
+	assert.Len(t, infos, 1)
+	assert.Equal(t, "other", infos[0].Name)
+}
+
+func Test_Subscriptions(t *testing.T) {
+	state := DefaultState()
+	state.Subscribe(NewSubscription("name").With(Name).Calls(func(CallbackArgs) {}).Calls(func(CallbackArgs) {}))
+	state.Subscribe(NewSubscription("job").WithNested(Job, Title).CallsE(func(CallbackArgs) error { return errRejected }))
+	state.OnError(func(string, error) {})
+	state.Set(Name, "Mike")
+	state.SetNested(Path{Job, Title}, "Developer")
+	state.Set(Name, "Paul")
+	assert.Equal(t, []SubscriptionInfo{
+		{Name: "name", Selectors: []Selector{Name}, Callbacks: 2, Notified: 2},
+		{Name: "job", Selectors: []Selector{Path{Job, Title}}, Callbacks: 1, Notified: 1, Failures: 1},
+	}, state.Subscriptions())
+}
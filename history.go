@@ -0,0 +1,184 @@
+package transfig
+
+// history keeps the undo and redo stacks of a State. Each entry holds the
+// changes made by a single commit (a Set, a ClearNested or a whole Batch).
+type history struct {
+	limit   int
+	exclude []Path
+	undo    [][]applied
+	redo    [][]applied
+}
+
+// record pushes a new undo entry with the changes made by a commit and
+// discards the redo stack.
+func (h *history) record(changes []applied) {
+	entry := h.filter(changes)
+	if len(entry) == 0 {
+		return
+	}
+	h.undo = h.push(h.undo, entry)
+	h.redo = nil
+}
+
+func (h *history) push(stack [][]applied, entry []applied) [][]applied {
+	stack = append(stack, entry)
+	if h.limit > 0 && len(stack) > h.limit {
+		stack = stack[len(stack)-h.limit:]
+	}
+	return stack
+}
+
+func (h *history) excluded(path Path) bool {
+	for _, e := range h.exclude {
+		if len(e) <= len(path) && e.Contains(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// reverts returns the mutations that undo an entry, in the order in which
+// they must be applied.
+func reverts(entry []applied) []mutation {
+	mutations := make([]mutation, 0, len(entry))
+	for i := len(entry) - 1; i >= 0; i-- {
+		mutations = append(mutations, entry[i].revert)
+	}
+	return mutations
+}
+
+// replays returns the mutations that redo an entry.
+func replays(entry []applied) []mutation {
+	mutations := make([]mutation, 0, len(entry))
+	for _, c := range entry {
+		mutations = append(mutations, c.mutation())
+	}
+	return mutations
+}
+
+// preserve appends to `mutations` the ones that keep the excluded paths as
+// they are in `values`. Undoing or redoing an entry may set or clear an
+// ancestor of an excluded path, which would otherwise revert changes that
+// were never recorded.
+func (h *history) preserve(values *pmap, mutations []mutation) []mutation {
+	for _, e := range h.exclude {
+		for _, m := range mutations {
+			if len(m.path) >= len(e) || !m.path.Contains(e) {
+				continue
+			}
+			if value, found := pmapGetNested(values, e); found {
+				mutations = append(mutations, mutation{op: OpSet, path: e, value: value})
+			} else {
+				mutations = append(mutations, mutation{op: OpClear, path: e})
+			}
+			break
+		}
+	}
+	return mutations
+}
+
+// filter returns the changes to paths that are not excluded
+func (h *history) filter(changes []applied) []applied {
+	entry := []applied{}
+	for _, c := range changes {
+		if !h.excluded(c.Path) {
+			entry = append(entry, c)
+		}
+	}
+	return entry
+}
+
+// EnableHistory starts recording every change to the state so that it can be
+// undone and redone. Every Set, SetNested and ClearNested call is recorded as
+// one entry, and so is every Batch. At most `limit` entries are kept, or all
+// of them if `limit` is zero or negative. Changes to `exclude` paths (or to
+// any path nested in them) are not recorded, and undoing or redoing an entry
+// leaves them as they are. Calling EnableHistory again
+// discards the recorded history.
+func (s *State) EnableHistory(limit int, exclude ...Path) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = &history{limit: limit, exclude: exclude}
+}
+
+// Undo reverts the last recorded entry and returns true, or returns false if
+// there is nothing to undo or if the reverted values would not match the
+// schema. Subscriptions are notified as usual.
+func (s *State) Undo() bool {
+	undone := true
+	err := s.update(func(chain []string) (err error) {
+		undone, err = s.undo(chain)
+		return err
+	})
+	return undone && err == nil
+}
+
+// undo implements Undo. Returns false if there is nothing to undo.
+func (s *State) undo(chain []string) (bool, error) {
+	s.mu.Lock()
+	if s.history == nil || len(s.history.undo) == 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	h := s.history
+	entry := h.undo[len(h.undo)-1]
+	changes, err := s.mutate(h.preserve(s.values, reverts(entry)), chain)
+	if err != nil {
+		s.mu.Unlock()
+		return false, err
+	}
+	s.logAction(changes, "")
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = h.push(h.redo, entry)
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Redo applies again the last undone entry and returns true, or returns false
+// if there is nothing to redo or if the values would not match the schema.
+// Subscriptions are notified as usual.
+func (s *State) Redo() bool {
+	redone := true
+	err := s.update(func(chain []string) (err error) {
+		redone, err = s.redo(chain)
+		return err
+	})
+	return redone && err == nil
+}
+
+// redo implements Redo. Returns false if there is nothing to redo.
+func (s *State) redo(chain []string) (bool, error) {
+	s.mu.Lock()
+	if s.history == nil || len(s.history.redo) == 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	h := s.history
+	entry := h.redo[len(h.redo)-1]
+	changes, err := s.mutate(h.preserve(s.values, replays(entry)), chain)
+	if err != nil {
+		s.mu.Unlock()
+		return false, err
+	}
+	s.logAction(changes, "")
+	h.redo = h.redo[:len(h.redo)-1]
+	if entry := h.filter(changes); len(entry) > 0 {
+		h.undo = h.push(h.undo, entry)
+	}
+	s.mu.Unlock()
+	return true, nil
+}
+
+// CanUndo returns true if there is an entry to undo
+func (s *State) CanUndo() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history != nil && len(s.history.undo) > 0
+}
+
+// CanRedo returns true if there is an entry to redo
+func (s *State) CanRedo() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history != nil && len(s.history.redo) > 0
+}
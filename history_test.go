@@ -0,0 +1,147 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_History_Disabled(t *testing.T) {
+	state := DefaultState()
+	state.Set(Name, "Mike")
+	assert.False(t, state.CanUndo())
+	assert.False(t, state.Undo())
+	assert.False(t, state.Redo())
+}
+
+func Test_History_UndoRedoSet(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(0)
+	state.Set(Name, "Mike")
+	state.Set(Name, "Paul")
+
+	assert.True(t, state.Undo())
+	value, _ := state.Get(Name)
+	assert.Equal(t, "Mike", value)
+	assert.True(t, state.CanRedo())
+
+	assert.True(t, state.Undo())
+	value, _ = state.Get(Name)
+	assert.Equal(t, "John", value)
+	assert.False(t, state.CanUndo())
+
+	assert.True(t, state.Redo())
+	assert.True(t, state.Redo())
+	value, _ = state.Get(Name)
+	assert.Equal(t, "Paul", value)
+	assert.False(t, state.CanRedo())
+}
+
+func Test_History_UndoClearNested(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	state.EnableHistory(0)
+	state.ClearNested(Path{Job, Title})
+	state.Undo()
+	value, found := state.GetNested(Job, Title)
+	assert.True(t, found)
+	assert.Equal(t, "Developer", value)
+}
+
+func Test_History_UndoRestoresReplacedParent(t *testing.T) {
+	state := DefaultState()
+	state.Set(Job, "Foo")
+	state.EnableHistory(0)
+	state.SetNested(Path{Job, Compensation, Ammount}, 1000)
+	state.Undo()
+	assert.Equal(t, CallbackArgs{Name: "John", Age: 30, Job: "Foo"}, state.AsMap())
+}
+
+func Test_History_UndoRemovesCreatedParent(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(0)
+	state.SetNested(Path{Job, Compensation, Ammount}, 1000)
+	state.Undo()
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
+
+func Test_History_BatchIsOneEntry(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(0)
+	_ = state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "Mike")
+		tx.Set(Name, "Paul")
+		tx.ClearNested(Path{Age})
+		return nil
+	})
+	state.Undo()
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+	assert.False(t, state.CanUndo())
+}
+
+func Test_History_NewChangeDiscardsRedo(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(0)
+	state.Set(Name, "Mike")
+	state.Undo()
+	state.Set(Age, 40)
+	assert.False(t, state.CanRedo())
+}
+
+func Test_History_Limit(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(2)
+	state.Set(Age, 31)
+	state.Set(Age, 32)
+	state.Set(Age, 33)
+	assert.True(t, state.Undo())
+	assert.True(t, state.Undo())
+	assert.False(t, state.Undo())
+	value, _ := state.Get(Age)
+	assert.Equal(t, 31, value)
+}
+
+func Test_History_Exclude(t *testing.T) {
+	Cursor := KeyString("cursor")
+	state := DefaultState()
+	state.EnableHistory(0, Path{Cursor})
+	state.Set(Name, "Mike")
+	state.SetNested(Path{Cursor, KeyString("line")}, 10)
+	state.Undo()
+	name, _ := state.Get(Name)
+	assert.Equal(t, "John", name)
+	line, _ := state.GetNested(Cursor, KeyString("line"))
+	assert.Equal(t, 10, line)
+	assert.False(t, state.CanUndo())
+}
+
+func Test_History_UndoKeepsExcludedNestedPath(t *testing.T) {
+	Doc, Text, Cursor := KeyString("doc"), KeyString("text"), KeyString("cursor")
+	state := NewState()
+	state.EnableHistory(0, Path{Doc, Cursor})
+	state.SetNested(Path{Doc, Text}, "hello")
+	state.SetNested(Path{Doc, Cursor}, 5)
+
+	assert.True(t, state.Undo())
+	assert.Equal(t, CallbackArgs{Doc: map[KeyString]interface{}{Cursor: 5}}, state.AsMap())
+
+	state.SetNested(Path{Doc, Cursor}, 7)
+	assert.True(t, state.Redo())
+	assert.Equal(t, CallbackArgs{Doc: map[KeyString]interface{}{Text: "hello", Cursor: 7}}, state.AsMap())
+	assert.True(t, state.Undo())
+	assert.Equal(t, CallbackArgs{Doc: map[KeyString]interface{}{Cursor: 7}}, state.AsMap())
+}
+
+func Test_History_UndoNotifiesSubscriptions(t *testing.T) {
+	state := DefaultState()
+	state.EnableHistory(0)
+	state.Set(Name, "Mike")
+	callbackArgs := make(map[KeyString]interface{})
+	sub := NewSubscription("subName").With(Name).Calls(func(args CallbackArgs) { callbackArgs = args })
+	state.Subscribe(sub)
+	state.Undo()
+	assert.Equal(t, map[KeyString]interface{}{Name: "John"}, callbackArgs)
+	state.Redo()
+	assert.Equal(t, map[KeyString]interface{}{Name: "Mike"}, callbackArgs)
+}
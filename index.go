@@ -0,0 +1,142 @@
+package transfig
+
+// subscriptionIndex indexes subscriptions by the paths they are subscribed
+// to, so that finding the subscriptions affected by a change costs in
+// proportion to the number of matching subscriptions, not to the total.
+//
+// Path and KeyString selectors are stored in a trie keyed by KeyString.
+// Wildcard selectors (and empty paths) match every path, so they are stored
+// at the root. Typed keys are indexed by their path. Selectors of any other
+// type can't be indexed, and the subscriptions using them are checked one by
+// one with `Contains`.
+type subscriptionIndex struct {
+	root     *indexNode
+	paths    map[*Subscription][]Path
+	fallback map[*Subscription]bool
+}
+
+type indexNode struct {
+	children map[KeyString]*indexNode
+	subs     map[*Subscription]int
+}
+
+func newIndexNode() *indexNode {
+	return &indexNode{
+		children: make(map[KeyString]*indexNode),
+		subs:     make(map[*Subscription]int),
+	}
+}
+
+func newSubscriptionIndex() *subscriptionIndex {
+	return &subscriptionIndex{
+		root:     newIndexNode(),
+		paths:    make(map[*Subscription][]Path),
+		fallback: make(map[*Subscription]bool),
+	}
+}
+
+// pathSelector is implemented by selectors that behave like a Path
+type pathSelector interface {
+	indexPath() Path
+}
+
+// indexPath returns the path under which a selector is indexed. The boolean
+// is false if the selector can't be indexed.
+func indexPath(selector Selector) (Path, bool) {
+	switch v := selector.(type) {
+	case Path:
+		return v, true
+	case KeyString:
+		return Path{v}, true
+	case Wildcard:
+		return Path{}, true
+	case pathSelector:
+		return v.indexPath(), true
+	}
+	return nil, false
+}
+
+// add indexes a subscription by its current selectors
+func (idx *subscriptionIndex) add(sub *Subscription) {
+	paths := []Path{}
+	for _, selector := range sub.selectors {
+		path, ok := indexPath(selector)
+		if !ok {
+			idx.fallback[sub] = true
+			continue
+		}
+		path = append(Path{}, path...)
+		paths = append(paths, path)
+		node := idx.root
+		for _, k := range path {
+			child, found := node.children[k]
+			if !found {
+				child = newIndexNode()
+				node.children[k] = child
+			}
+			node = child
+		}
+		node.subs[sub]++
+	}
+	idx.paths[sub] = paths
+}
+
+// remove removes a subscription from the index
+func (idx *subscriptionIndex) remove(sub *Subscription) {
+	for _, path := range idx.paths[sub] {
+		idx.removePath(idx.root, path, sub)
+	}
+	delete(idx.paths, sub)
+	delete(idx.fallback, sub)
+}
+
+// removePath removes one reference of `sub` at `path` below `node` and prunes
+// the nodes left empty. Returns true if `node` itself is left empty.
+func (idx *subscriptionIndex) removePath(node *indexNode, path Path, sub *Subscription) bool {
+	if len(path) == 0 {
+		node.subs[sub]--
+		if node.subs[sub] <= 0 {
+			delete(node.subs, sub)
+		}
+	} else if child, found := node.children[path[0]]; found {
+		if idx.removePath(child, path[1:], sub) {
+			delete(node.children, path[0])
+		}
+	}
+	return len(node.subs) == 0 && len(node.children) == 0
+}
+
+// match adds to `matched` every subscription subscribed to `path`, that is,
+// with a selector that contains `path` or that is contained by it.
+func (idx *subscriptionIndex) match(path Path, matched map[*Subscription]bool) {
+	node := idx.root
+	for _, k := range path {
+		for sub := range node.subs {
+			matched[sub] = true
+		}
+		child, found := node.children[k]
+		if !found {
+			node = nil
+			break
+		}
+		node = child
+	}
+	if node != nil {
+		node.collect(matched)
+	}
+	for sub := range idx.fallback {
+		if !matched[sub] && sub.subscribedTo(path) {
+			matched[sub] = true
+		}
+	}
+}
+
+// collect adds every subscription in the subtree to `matched`
+func (n *indexNode) collect(matched map[*Subscription]bool) {
+	for sub := range n.subs {
+		matched[sub] = true
+	}
+	for _, child := range n.children {
+		child.collect(matched)
+	}
+}
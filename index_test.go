@@ -0,0 +1,97 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+// prefixSelector is a custom Selector, unknown to the subscription index
+type prefixSelector struct{ key KeyString }
+
+func (p prefixSelector) Select(m map[KeyString]interface{}) KeyValIter {
+	return p.key.Select(m)
+}
+
+func (p prefixSelector) Contains(path Path) bool {
+	return p.key.Contains(path)
+}
+
+func Test_Index_CustomSelector(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	sub := NewSubscription("subName").With(prefixSelector{Name}).Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	state.Set(Age, 40)
+	assert.Equal(t, 1, callCount)
+}
+
+func Test_Index_ParentAndChildPaths(t *testing.T) {
+	state := DefaultState()
+	calls := map[string]int{}
+	subscribe := func(name string, keys ...KeyString) {
+		state.Subscribe(NewSubscription(name).WithNested(keys...).Calls(func(CallbackArgs) { calls[name]++ }))
+	}
+	subscribe("job", Job)
+	subscribe("title", Job, Title)
+	subscribe("ammount", Job, Compensation, Ammount)
+	state.Subscribe(NewSubscription("all").With(Wildcard{}).Calls(func(CallbackArgs) { calls["all"]++ }))
+
+	state.SetNested(Path{Job, Title}, "Developer")
+	assert.Equal(t, map[string]int{"job": 1, "title": 1, "all": 1}, calls)
+
+	state.Set(Job, "Foo")
+	assert.Equal(t, map[string]int{"job": 2, "title": 2, "ammount": 1, "all": 2}, calls)
+}
+
+func Test_Index_Unsubscribe(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	state.Subscribe(NewSubscription("subName").WithNested(Job, Title).Calls(func(CallbackArgs) { callCount++ }))
+	state.Unsubscribe("subName")
+	state.SetNested(Path{Job, Title}, "Developer")
+	assert.Equal(t, 0, callCount)
+}
+
+func Test_Index_CancelOneOfSameName(t *testing.T) {
+	state := DefaultState()
+	oldCount := 0
+	newCount := 0
+	old := state.Subscribe(NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { oldCount++ }))
+	state.Subscribe(NewSubscription("subName").With(Age).Calls(func(CallbackArgs) { newCount++ }))
+	old.Cancel()
+	state.Set(Name, "Mike")
+	state.Set(Age, 40)
+	assert.Equal(t, 0, oldCount)
+	assert.Equal(t, 1, newCount)
+}
+
+func Test_Index_RepeatedSelector(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	sub := NewSubscription("subName").With(Name).WithNested(Name).Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	assert.Equal(t, 1, callCount)
+}
+
+func Test_Index_SelectorAddedAfterSubscribe(t *testing.T) {
+	state := DefaultState()
+	other := DefaultState()
+	callCount := 0
+	sub := NewSubscription("subName").With(Name).Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	other.Subscribe(sub)
+	sub.WithNested(Job, Title)
+	state.SetNested(Path{Job, Title}, "Developer")
+	other.SetNested(Path{Job, Title}, "Developer")
+	assert.Equal(t, 2, callCount)
+
+	state.Unsubscribe("subName")
+	sub.With(Age)
+	state.Set(Age, 40)
+	other.Set(Age, 40)
+	assert.Equal(t, 3, callCount)
+}
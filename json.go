@@ -0,0 +1,130 @@
+package transfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// MarshalJSON implements json.Marshaler. The state values are marshalled as a
+// JSON object. Returns an error if any value can't be represented in JSON.
+func (s *State) MarshalJSON() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := json.Marshal(s.values)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal state: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The JSON object replaces the
+// state values, as in State.Replace. Objects are decoded as nested maps, and
+// numbers as int when they are integers that fit in one, or float64
+// otherwise. If the state has a schema, values of fields with a Type are
+// decoded into that type instead, and the result is validated as usual.
+func (s *State) UnmarshalJSON(data []byte) error {
+	s.mu.Lock()
+	if s.values == nil {
+		s.subscriptions = make(map[*Subscription]*registration)
+		s.names = make(map[string]map[*Subscription]bool)
+		s.index = newSubscriptionIndex()
+		s.values = &pmap{}
+	}
+	schema := s.schema
+	s.mu.Unlock()
+
+	values, err := jsonDecodeObject(Path{}, data, schema)
+	if err != nil {
+		return err
+	}
+	return s.Replace(values)
+}
+
+// NewStateFromJSON creates a new state from a JSON object read from `r`
+func NewStateFromJSON(r io.Reader) (*State, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s := NewState()
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// jsonDecodeObject decodes a JSON object into a map, guided by `schema`,
+// which may be nil.
+func jsonDecodeObject(path Path, data []byte, schema Schema) (map[KeyString]interface{}, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("can't unmarshal %s: %w", jsonPathString(path), err)
+	}
+	values := make(map[KeyString]interface{}, len(raw))
+	for key, rawValue := range raw {
+		keyPath := append(append(Path{}, path...), KeyString(key))
+		value, err := jsonDecodeValue(keyPath, rawValue, schema[KeyString(key)])
+		if err != nil {
+			return nil, err
+		}
+		values[KeyString(key)] = value
+	}
+	return values, nil
+}
+
+// jsonDecodeValue decodes a JSON value, guided by `field`, which may be nil
+func jsonDecodeValue(path Path, data []byte, field *Field) (interface{}, error) {
+	if field != nil && field.Fields != nil && !bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return jsonDecodeObject(path, data, field.Fields)
+	}
+	if field != nil && field.Type != nil {
+		value := reflect.New(field.Type)
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return nil, fmt.Errorf("can't unmarshal %s: %w", jsonPathString(path), err)
+		}
+		return value.Elem().Interface(), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("can't unmarshal %s: %w", jsonPathString(path), err)
+	}
+	return fromJSON(value), nil
+}
+
+// fromJSON converts a value decoded by encoding/json (with UseNumber) into
+// the values used by the state.
+func fromJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[KeyString]interface{}, len(v))
+		for key, nested := range v {
+			m[KeyString(key)] = fromJSON(nested)
+		}
+		return m
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = fromJSON(nested)
+		}
+		return v
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, strconv.IntSize); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+func jsonPathString(path Path) string {
+	if len(path) == 0 {
+		return "state"
+	}
+	return pathString(path)
+}
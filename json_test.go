@@ -0,0 +1,100 @@
+package transfig_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_MarshalJSON(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	data, err := json.Marshal(state)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name": "John", "age": 30, "job": {"title": "Developer"}}`, string(data))
+}
+
+func Test_MarshalJSON_UnsupportedValue(t *testing.T) {
+	state := DefaultState()
+	state.Set(Job, make(chan int))
+	_, err := json.Marshal(state)
+	assert.ErrorContains(t, err, "can't marshal state")
+}
+
+func Test_UnmarshalJSON_RoundTrip(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Compensation, Ammount}, 1000.5)
+	state.SetNested(Path{Job, KeyString("tags")}, []interface{}{"a", 1})
+	data, err := json.Marshal(state)
+	assert.NoError(t, err)
+
+	newState := NewState()
+	assert.NoError(t, json.Unmarshal(data, newState))
+	assert.Equal(t, state.AsMap(), newState.AsMap())
+}
+
+func Test_UnmarshalJSON_ZeroState(t *testing.T) {
+	var state State
+	assert.NoError(t, json.Unmarshal([]byte(`{"name": "Mike"}`), &state))
+	value, _ := state.Get(Name)
+	assert.Equal(t, "Mike", value)
+}
+
+func Test_UnmarshalJSON_ReplacesValuesAndNotifies(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	calls := map[string]int{}
+	for _, key := range []KeyString{Name, Age, Job} {
+		name := string(key)
+		state.Subscribe(NewSubscription(name).With(key).Calls(func(CallbackArgs) { calls[name]++ }))
+	}
+
+	err := state.UnmarshalJSON([]byte(`{"name": "Mike", "job": {"title": "Developer"}}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, CallbackArgs{Name: "Mike", Job: map[KeyString]interface{}{Title: "Developer"}}, state.AsMap())
+	assert.Equal(t, map[string]int{"name": 1, "age": 1}, calls)
+}
+
+func Test_UnmarshalJSON_Invalid(t *testing.T) {
+	state := DefaultState()
+	assert.Error(t, state.UnmarshalJSON([]byte(`[1, 2]`)))
+	assert.Error(t, state.UnmarshalJSON([]byte(`{"name": `)))
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
+
+func Test_UnmarshalJSON_WithSchema(t *testing.T) {
+	Since := KeyString("since")
+	state := NewState()
+	schema := Schema{
+		Age: {Type: reflect.TypeFor[float64]()},
+		Job: {Fields: Schema{
+			Since: {Type: reflect.TypeFor[time.Time]()},
+		}},
+	}
+	assert.NoError(t, state.SetSchema(schema))
+
+	err := state.UnmarshalJSON([]byte(`{"age": 30, "job": {"since": "2020-01-02T00:00:00Z"}}`))
+
+	assert.NoError(t, err)
+	age, _ := state.Get(Age)
+	assert.Equal(t, 30.0, age)
+	since, _ := state.GetNested(Job, Since)
+	assert.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), since)
+
+	err = state.UnmarshalJSON([]byte(`{"age": "thirty"}`))
+	assert.ErrorContains(t, err, "can't unmarshal 'age'")
+	err = state.UnmarshalJSON([]byte(`{"name": "John"}`))
+	assert.EqualError(t, err, "invalid value at 'name': unknown key")
+}
+
+func Test_NewStateFromJSON(t *testing.T) {
+	state, err := NewStateFromJSON(strings.NewReader(`{"name": "John", "age": 30, "height": 1.8}`))
+	assert.NoError(t, err)
+	assert.Equal(t, CallbackArgs{Name: "John", Age: 30, KeyString("height"): 1.8}, state.AsMap())
+}
@@ -0,0 +1,145 @@
+package transfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPathNotFound is returned by State.ApplyJSONPatch when an operation
+// targets a path that does not exist
+var ErrPathNotFound = errors.New("path not found")
+
+// jsonPatchOperation is an operation of a RFC 6902 JSON Patch
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch exports changes as a RFC 6902 JSON Patch. Clears become "remove"
+// operations, and sets become "replace" operations if the path existed
+// before, or "add" operations otherwise.
+func JSONPatch(changes []Change) ([]byte, error) {
+	operations := make([]jsonPatchOperation, 0, len(changes))
+	for _, c := range changes {
+		if len(c.Path) == 0 {
+			return nil, fmt.Errorf("can't export a change with an empty path")
+		}
+		operation := jsonPatchOperation{Path: jsonPointer(c.Path)}
+		switch {
+		case c.Op == OpClear:
+			operation.Op = "remove"
+		case c.Existed:
+			operation.Op = "replace"
+		default:
+			operation.Op = "add"
+		}
+		if c.Op == OpSet {
+			value, err := json.Marshal(c.NewValue)
+			if err != nil {
+				return nil, fmt.Errorf("can't export the change at %s: %w", pathString(c.Path), err)
+			}
+			operation.Value = value
+		}
+		operations = append(operations, operation)
+	}
+	return json.Marshal(operations)
+}
+
+// ParseJSONPatch imports changes from a RFC 6902 JSON Patch. Only the "add",
+// "replace" and "remove" operations are supported. Every segment of the JSON
+// Pointers is taken as a map key, including array indexes, and values are
+// decoded as in State.UnmarshalJSON without a schema.
+//
+// State.Apply does not check that the paths of "replace" and "remove"
+// operations exist, as RFC 6902 requires, and removing a missing path is not
+// an error. Use State.ApplyJSONPatch to apply a patch with those checks.
+func ParseJSONPatch(data []byte) ([]Change, error) {
+	return ParseJSONPatchWithSchema(data, nil)
+}
+
+// ParseJSONPatchWithSchema is ParseJSONPatch with the values decoded as in
+// State.UnmarshalJSON with `schema`, so that values of fields with a Type are
+// decoded into that type. `schema` may be nil.
+func ParseJSONPatchWithSchema(data []byte, schema Schema) ([]Change, error) {
+	operations := []jsonPatchOperation{}
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, fmt.Errorf("can't parse JSON Patch: %w", err)
+	}
+	changes := make([]Change, 0, len(operations))
+	for i, operation := range operations {
+		path, err := parseJSONPointer(operation.Path)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse JSON Patch operation %d: %w", i, err)
+		}
+		c := Change{Path: path}
+		switch operation.Op {
+		case "add", "replace":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("can't parse JSON Patch operation %d: missing value", i)
+			}
+			value, err := jsonDecodeValue(path, operation.Value, schema.fieldAt(path))
+			if err != nil {
+				return nil, fmt.Errorf("can't parse JSON Patch operation %d: %w", i, err)
+			}
+			c.Op, c.NewValue, c.Existed = OpSet, value, operation.Op == "replace"
+		case "remove":
+			c.Op, c.Existed = OpClear, true
+		default:
+			return nil, fmt.Errorf("can't parse JSON Patch operation %d: unsupported op %q", i, operation.Op)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// ApplyJSONPatch applies a RFC 6902 JSON Patch atomically, as a single Batch.
+// The patch is parsed as in ParseJSONPatchWithSchema with the state schema.
+// As RFC 6902 requires, "replace"
+// and "remove" operations fail if their path does not exist and "add"
+// operations fail if the parent of their path is not a map, in which case
+// nothing is applied and an error wrapping ErrPathNotFound is returned.
+func (s *State) ApplyJSONPatch(data []byte) error {
+	changes, err := ParseJSONPatchWithSchema(data, s.Schema())
+	if err != nil {
+		return err
+	}
+	mutations := changeMutations(changes)
+	for i, c := range changes {
+		if c.Existed {
+			mutations[i].require = requireTarget
+		} else {
+			mutations[i].require = requireParent
+		}
+	}
+	return s.commit(mutations)
+}
+
+var (
+	jsonPointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// jsonPointer returns the RFC 6901 JSON Pointer for a path
+func jsonPointer(path Path) string {
+	var b strings.Builder
+	for _, k := range path {
+		b.WriteString("/")
+		b.WriteString(jsonPointerEscaper.Replace(string(k)))
+	}
+	return b.String()
+}
+
+// parseJSONPointer parses a RFC 6901 JSON Pointer into a path
+func parseJSONPointer(pointer string) (Path, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	path := Path{}
+	for _, segment := range strings.Split(pointer[1:], "/") {
+		path = append(path, KeyString(jsonPointerUnescaper.Replace(segment)))
+	}
+	return path, nil
+}
@@ -0,0 +1,131 @@
+package transfig_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_JSONPatch(t *testing.T) {
+	changes := []Change{
+		{Op: OpClear, Path: Path{Age}, OldValue: 30, Existed: true},
+		{Op: OpSet, Path: Path{Job, Ammount}, NewValue: 1},
+		{Op: OpSet, Path: Path{Job, "a/b~c"}, OldValue: "x", NewValue: map[KeyString]interface{}{Title: "y"}, Existed: true},
+	}
+	data, err := JSONPatch(changes)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "remove", "path": "/age"},
+		{"op": "add", "path": "/job/ammount", "value": 1},
+		{"op": "replace", "path": "/job/a~1b~0c", "value": {"title": "y"}}
+	]`, string(data))
+}
+
+func Test_JSONPatch_Errors(t *testing.T) {
+	_, err := JSONPatch([]Change{{Op: OpSet, Path: Path{}, NewValue: 1}})
+	assert.Error(t, err)
+	_, err = JSONPatch([]Change{{Op: OpSet, Path: Path{Name}, NewValue: make(chan int)}})
+	assert.ErrorContains(t, err, "'name'")
+}
+
+func Test_ParseJSONPatch(t *testing.T) {
+	changes, err := ParseJSONPatch([]byte(`[
+		{"op": "remove", "path": "/age"},
+		{"op": "add", "path": "/job/ammount", "value": 1},
+		{"op": "replace", "path": "/job/a~1b~0c", "value": {"title": 1.5}}
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Op: OpClear, Path: Path{Age}, Existed: true},
+		{Op: OpSet, Path: Path{Job, Ammount}, NewValue: 1},
+		{Op: OpSet, Path: Path{Job, "a/b~c"}, NewValue: map[KeyString]interface{}{Title: 1.5}, Existed: true},
+	}, changes)
+}
+
+func Test_ParseJSONPatchWithSchema(t *testing.T) {
+	schema := Schema{
+		Age: {Type: reflect.TypeOf(0.0)},
+		Job: {Fields: Schema{Title: {Type: reflect.TypeOf([]string{})}}},
+	}
+	changes, err := ParseJSONPatchWithSchema([]byte(`[
+		{"op": "add", "path": "/age", "value": 3},
+		{"op": "add", "path": "/job", "value": {"title": ["a"]}},
+		{"op": "replace", "path": "/job/title", "value": ["b"]}
+	]`), schema)
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Op: OpSet, Path: Path{Age}, NewValue: 3.0},
+		{Op: OpSet, Path: Path{Job}, NewValue: map[KeyString]interface{}{Title: []string{"a"}}},
+		{Op: OpSet, Path: Path{Job, Title}, NewValue: []string{"b"}, Existed: true},
+	}, changes)
+	_, err = ParseJSONPatchWithSchema([]byte(`[{"op": "add", "path": "/age", "value": "x"}]`), schema)
+	assert.Error(t, err)
+}
+
+func Test_ParseJSONPatch_Errors(t *testing.T) {
+	for _, patch := range []string{
+		`{}`,
+		`[{"op": "move", "from": "/a", "path": "/b"}]`,
+		`[{"op": "add", "path": "a"}]`,
+		`[{"op": "add", "path": "/a"}]`,
+	} {
+		_, err := ParseJSONPatch([]byte(patch))
+		assert.Error(t, err, patch)
+	}
+}
+
+func Test_JSONPatch_RoundTrip(t *testing.T) {
+	a := DefaultState()
+	b := DefaultState()
+	b.SetNested(Path{Job, Title}, "Developer")
+	b.ClearNested(Path{Age})
+	data, err := JSONPatch(Diff(a.AsMap(), b.AsMap()))
+	assert.NoError(t, err)
+	changes, err := ParseJSONPatch(data)
+	assert.NoError(t, err)
+	assert.NoError(t, a.Apply(changes))
+	assert.Equal(t, b.AsMap(), a.AsMap())
+}
+
+func Test_ApplyJSONPatch(t *testing.T) {
+	state := DefaultState()
+	assert.NoError(t, state.ApplyJSONPatch([]byte(`[
+		{"op": "replace", "path": "/name", "value": "Mike"},
+		{"op": "add", "path": "/job", "value": {}},
+		{"op": "add", "path": "/job/title", "value": "Developer"},
+		{"op": "remove", "path": "/age"}
+	]`)))
+	expected := DefaultState()
+	expected.Set(Name, "Mike")
+	expected.SetNested(Path{Job, Title}, "Developer")
+	expected.ClearNested(Path{Age})
+	assert.Equal(t, expected.AsMap(), state.AsMap())
+}
+
+func Test_ApplyJSONPatch_MissingPath(t *testing.T) {
+	patches := []string{
+		`[{"op": "remove", "path": "/missingKey"}]`,
+		`[{"op": "replace", "path": "/missingKey", "value": 1}]`,
+		`[{"op": "add", "path": "/job/title", "value": "Developer"}]`,
+		`[{"op": "set", "path": "/name", "value": "Mike"}]`,
+		`[{"op": "replace", "path": "/name", "value": "Mike"}, {"op": "remove", "path": "/job"}]`,
+	}
+	for i, patch := range patches {
+		state := DefaultState()
+		err := state.ApplyJSONPatch([]byte(patch))
+		assert.Error(t, err, patch)
+		if i != 3 {
+			assert.ErrorIs(t, err, ErrPathNotFound, patch)
+		}
+		assert.Equal(t, DefaultState().AsMap(), state.AsMap(), patch)
+	}
+}
+
+func Test_ApplyJSONPatch_MissingPathWithMiddleware(t *testing.T) {
+	state := DefaultState()
+	state.Use(func(next ChangeHandler) ChangeHandler { return next })
+	err := state.ApplyJSONPatch([]byte(`[{"op": "remove", "path": "/missingKey"}]`))
+	assert.ErrorIs(t, err, ErrPathNotFound)
+}
@@ -0,0 +1,123 @@
+package transfig
+
+import "sync"
+
+// layeredSubscriptionName is the name of the subscription a LayeredState
+// adds to each of its layers
+const layeredSubscriptionName = "transfig.LayeredState"
+
+// Layer is a named State used as a layer of a LayeredState
+type Layer struct {
+	Name  string
+	State *State
+}
+
+// LayeredState resolves values from several ordered layers, e.g. defaults,
+// file, env and runtime overrides, each of which is a State. The value at a
+// path is the one from the highest layer that defines it, and maps are
+// merged across layers. The resolved values are kept in an effective State,
+// so subscriptions are only notified when the effective value changes, e.g.
+// when a layer sets a value that is hidden by a higher layer they are not,
+// and when an override is cleared they are notified of the value of the
+// layer below.
+type LayeredState struct {
+	mu         sync.Mutex
+	layers     []Layer
+	effective  *State
+	refreshing bool
+	stale      bool
+}
+
+// NewLayeredState creates a new LayeredState from layers ordered from the
+// lowest to the highest precedence.
+func NewLayeredState(layers ...Layer) *LayeredState {
+	l := &LayeredState{layers: layers, effective: NewState()}
+	for _, layer := range layers {
+		sub := NewSubscription(layeredSubscriptionName).With(Wildcard{}).Calls(func(CallbackArgs) { l.refresh() })
+		layer.State.Subscribe(sub)
+	}
+	l.refresh()
+	return l
+}
+
+// refresh recomputes the effective values from the layers. Refreshes are
+// serialized without holding the lock while the effective State notifies its
+// subscriptions, since they may change a layer and so refresh again: a
+// refresh requested while another one is running marks the values as stale
+// and leaves it to the running one to recompute them again.
+func (l *LayeredState) refresh() {
+	l.mu.Lock()
+	l.stale = true
+	if l.refreshing {
+		l.mu.Unlock()
+		return
+	}
+	l.refreshing = true
+	for l.stale {
+		l.stale = false
+		l.mu.Unlock()
+		values := make(map[KeyString]interface{})
+		for _, layer := range l.layers {
+			mapMerge(values, layer.State.AsMap())
+		}
+		_ = l.effective.Replace(values)
+		l.mu.Lock()
+	}
+	l.refreshing = false
+	l.mu.Unlock()
+}
+
+// Layer returns the State of the layer with the given name, or nil if there
+// is none
+func (l *LayeredState) Layer(name string) *State {
+	for _, layer := range l.layers {
+		if layer.Name == name {
+			return layer.State
+		}
+	}
+	return nil
+}
+
+// Effective returns the State holding the effective values. It can be read
+// and subscribed to, but changes made to it directly are overwritten as soon
+// as any layer changes.
+func (l *LayeredState) Effective() *State {
+	return l.effective
+}
+
+// Get returns the effective value for a specific key
+func (l *LayeredState) Get(key KeyString) (value interface{}, found bool) {
+	return l.effective.Get(key)
+}
+
+// GetNested returns the effective value for a nested key
+func (l *LayeredState) GetNested(keys ...KeyString) (value interface{}, found bool) {
+	return l.effective.GetNested(keys...)
+}
+
+// AsMap returns a copy of the effective values as a map
+func (l *LayeredState) AsMap() CallbackArgs {
+	return l.effective.AsMap()
+}
+
+// Subscribe adds a subscription to the effective values
+func (l *LayeredState) Subscribe(subscription *Subscription) SubscriptionHandle {
+	return l.effective.Subscribe(subscription)
+}
+
+// Unsubscribe removes the subscriptions named `subscriptionName` from the
+// effective values
+func (l *LayeredState) Unsubscribe(subscriptionName string) {
+	l.effective.Unsubscribe(subscriptionName)
+}
+
+// SourceOf returns the name of the highest layer that defines a value at
+// `path`. The boolean is false if no layer defines it.
+func (l *LayeredState) SourceOf(path Path) (string, bool) {
+	for i := len(l.layers) - 1; i >= 0; i-- {
+		if _, found := l.layers[i].State.GetNested(path...); found {
+			return l.layers[i].Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+package transfig_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func defaultLayers() (*LayeredState, *State, *State) {
+	defaults := NewStateFromMap(map[KeyString]interface{}{
+		Name: "John",
+		Job:  map[KeyString]interface{}{Title: "Developer", Compensation: 1000},
+	})
+	overrides := NewState()
+	return NewLayeredState(Layer{"defaults", defaults}, Layer{"overrides", overrides}), defaults, overrides
+}
+
+func Test_LayeredState_Resolve(t *testing.T) {
+	layered, _, overrides := defaultLayers()
+	overrides.SetNested(Path{Job, Title}, "Manager")
+
+	title, _ := layered.GetNested(Job, Title)
+	assert.Equal(t, "Manager", title)
+	compensation, _ := layered.GetNested(Job, Compensation)
+	assert.Equal(t, 1000, compensation)
+	name, _ := layered.Get(Name)
+	assert.Equal(t, "John", name)
+
+	source, found := layered.SourceOf(Path{Job, Title})
+	assert.True(t, found)
+	assert.Equal(t, "overrides", source)
+	source, _ = layered.SourceOf(Path{Name})
+	assert.Equal(t, "defaults", source)
+	_, found = layered.SourceOf(Path{Age})
+	assert.False(t, found)
+}
+
+func Test_LayeredState_NotifiesOnEffectiveChange(t *testing.T) {
+	layered, defaults, overrides := defaultLayers()
+	overrides.SetNested(Path{Job, Title}, "Manager")
+	titles := []interface{}{}
+	layered.Subscribe(NewSubscription("subName").WithNested(Job, Title).CallsWithEvent(func(e ChangeEvent) {
+		titles = append(titles, e.NewValue)
+	}))
+
+	defaults.SetNested(Path{Job, Title}, "Senior Developer")
+	assert.Empty(t, titles)
+
+	overrides.SetNested(Path{Job, Title}, "Director")
+	assert.Equal(t, []interface{}{"Director"}, titles)
+
+	overrides.ClearNested(Path{Job, Title})
+	assert.Equal(t, []interface{}{"Director", "Senior Developer"}, titles)
+}
+
+func Test_LayeredState_SubscriberWritesToLayer(t *testing.T) {
+	a, b := KeyString("a"), KeyString("b")
+	base, over := NewState(), NewState()
+	layered := NewLayeredState(Layer{"base", base}, Layer{"over", over})
+	layered.Subscribe(NewSubscription("subName").With(a).Calls(func(args CallbackArgs) {
+		over.Set(b, args[a])
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		base.Set(a, 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deadlock")
+	}
+	value, _ := layered.Get(b)
+	assert.Equal(t, 1, value)
+}
+
+func Test_LayeredState_Layer(t *testing.T) {
+	layered, defaults, _ := defaultLayers()
+	assert.Same(t, defaults, layered.Layer("defaults"))
+	assert.Nil(t, layered.Layer("missing"))
+	layered.Layer("overrides").Set(Age, 30)
+	assert.Equal(t, CallbackArgs{
+		Name: "John",
+		Age:  30,
+		Job:  map[KeyString]interface{}{Title: "Developer", Compensation: 1000},
+	}, layered.AsMap())
+}
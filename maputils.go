@@ -1,14 +1,12 @@
 package transfig
 
+import "reflect"
+
 // Helper functions that work with maps
 func mapDeepCopy(m map[KeyString]interface{}) map[KeyString]interface{} {
-	newMap := make(map[KeyString]interface{})
+	newMap := make(map[KeyString]interface{}, len(m))
 	for k, v := range m {
-		if vAsMap, ok := v.(map[KeyString]interface{}); ok {
-			newMap[k] = mapDeepCopy(vAsMap)
-		} else {
-			newMap[k] = v
-		}
+		newMap[k] = valueCopy(v)
 	}
 	return newMap
 }
@@ -47,17 +45,161 @@ func mapGetNested(m map[KeyString]interface{}, keys []KeyString) (value interfac
 	return nil, false
 }
 
-// mapClearNested clears a nested key in a map
-func mapClearNested(m map[KeyString]interface{}, keys []KeyString) {
+// pmapGetNested gets a nested key in a pmap
+func pmapGetNested(p *pmap, keys []KeyString) (value interface{}, found bool) {
 	if len(keys) == 0 {
-		return
+		return nil, false
+	}
+	for _, k := range keys[:len(keys)-1] {
+		v, _ := p.get(k)
+		next, ok := v.(*pmap)
+		if !ok {
+			return nil, false
+		}
+		p = next
+	}
+	return p.get(keys[len(keys)-1])
+}
+
+// pmapWithNested returns a copy of `p` with `value` set at the nested `keys`.
+// Missing maps along `keys`, and values that are not maps, are replaced by
+// new maps.
+func pmapWithNested(p *pmap, keys []KeyString, value interface{}) *pmap {
+	if len(keys) == 0 {
+		return p
 	}
 	if len(keys) == 1 {
-		delete(m, keys[0])
-		return
+		return p.with(keys[0], value)
 	}
-	topValue := m[keys[0]]
-	if topValueAsMap, ok := topValue.(map[KeyString]interface{}); ok {
-		mapClearNested(topValueAsMap, keys[1:])
+	top, _ := p.get(keys[0])
+	topAsPmap, _ := top.(*pmap)
+	return p.with(keys[0], pmapWithNested(topAsPmap, keys[1:], value))
+}
+
+// pmapWithoutNested returns a copy of `p` without the nested `keys`, or `p`
+// itself if it doesn't have them
+func pmapWithoutNested(p *pmap, keys []KeyString) *pmap {
+	if len(keys) == 0 {
+		return p
+	}
+	if len(keys) == 1 {
+		return p.without(keys[0])
+	}
+	top, _ := p.get(keys[0])
+	topAsPmap, ok := top.(*pmap)
+	if !ok {
+		return p
+	}
+	newTop := pmapWithoutNested(topAsPmap, keys[1:])
+	if newTop == topAsPmap {
+		return p
+	}
+	return p.with(keys[0], newTop)
+}
+
+// pmapSelect returns the value selected by `path` in `p`, as Path.Select
+// does, copied as in valueCopy. `path` must not be empty.
+func pmapSelect(p *pmap, path Path) interface{} {
+	value, _ := p.get(path[0])
+	if len(path) == 1 {
+		return valueCopy(value)
+	}
+	nested, _ := value.(*pmap)
+	return map[KeyString]interface{}{path[1]: pmapSelect(nested, path[1:])}
+}
+
+// valueCopy returns a deep copy of `v` if it is a map, a slice or an array,
+// so that the copy can be handed over without sharing anything with the
+// state. A pmap is copied into a map[KeyString]interface{}. Other values are
+// returned as they are.
+func valueCopy(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case map[KeyString]interface{}:
+		return mapDeepCopy(vv)
+	case *pmap:
+		return vv.toMap()
+	case []interface{}:
+		newSlice := make([]interface{}, len(vv))
+		for i, elem := range vv {
+			newSlice[i] = valueCopy(elem)
+		}
+		return newSlice
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return reflectCopy(reflect.ValueOf(v)).Interface()
+	}
+	return v
+}
+
+// reflectCopy returns a deep copy of a typed map, slice or array, copying
+// each of its elements as in valueCopy
+func reflectCopy(rv reflect.Value) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
+		}
+		newValue := reflect.New(rv.Type()).Elem()
+		newValue.Set(reflect.ValueOf(valueCopy(rv.Interface())))
+		return newValue
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+		newSlice := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		if scalar(rv.Type().Elem()) {
+			reflect.Copy(newSlice, rv)
+			return newSlice
+		}
+		for i := 0; i < rv.Len(); i++ {
+			newSlice.Index(i).Set(reflectCopy(rv.Index(i)))
+		}
+		return newSlice
+	case reflect.Array:
+		newArray := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			newArray.Index(i).Set(reflectCopy(rv.Index(i)))
+		}
+		return newArray
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv
+		}
+		newMap := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			newMap.SetMapIndex(iter.Key(), reflectCopy(iter.Value()))
+		}
+		return newMap
+	}
+	return rv
+}
+
+// scalar returns true if values of type `t` can't share anything when copied
+func scalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// mapMerge deeply merges `src` into `dst`. Maps found in both are merged, and
+// any other value in `src` replaces the one in `dst`.
+func mapMerge(dst map[KeyString]interface{}, src map[KeyString]interface{}) {
+	for k, v := range src {
+		vAsMap, vIsMap := v.(map[KeyString]interface{})
+		dstAsMap, dstIsMap := dst[k].(map[KeyString]interface{})
+		if vIsMap && dstIsMap {
+			mapMerge(dstAsMap, vAsMap)
+			continue
+		}
+		dst[k] = v
 	}
 }
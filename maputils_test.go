@@ -1,6 +1,7 @@
 package transfig_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -93,3 +94,94 @@ func Test_MapGesNested_MissingNonMap(t *testing.T) {
 	assert.False(t, found)
 	assert.Nil(t, value)
 }
+
+func Test_MapMerge(t *testing.T) {
+	dst := map[KeyString]interface{}{
+		"key1": "value1",
+		"key2": map[KeyString]interface{}{"key3": "value3", "key4": "value4"},
+		"key5": "value5",
+	}
+	src := map[KeyString]interface{}{
+		"key2": map[KeyString]interface{}{"key3": "new3"},
+		"key5": map[KeyString]interface{}{"key6": "value6"},
+	}
+	MapMerge(dst, src)
+	assert.Equal(t, map[KeyString]interface{}{
+		"key1": "value1",
+		"key2": map[KeyString]interface{}{"key3": "new3", "key4": "value4"},
+		"key5": map[KeyString]interface{}{"key6": "value6"},
+	}, dst)
+}
+
+func Test_MapDeepCopy_CopiesSlices(t *testing.T) {
+	original := map[KeyString]interface{}{
+		"key1": []interface{}{map[KeyString]interface{}{"key2": "value2"}},
+		"key3": []string{"a", "b"},
+	}
+	copy := MapDeepCopy(original)
+	assert.Equal(t, original, copy)
+	copy["key1"].([]interface{})[0].(map[KeyString]interface{})["key2"] = "value4"
+	copy["key3"].([]string)[0] = "c"
+	assert.Equal(t, "value2", original["key1"].([]interface{})[0].(map[KeyString]interface{})["key2"])
+	assert.Equal(t, []string{"a", "b"}, original["key3"])
+}
+
+func Test_PmapWithNested(t *testing.T) {
+	p := NewPmap(map[KeyString]interface{}{
+		"key1": map[KeyString]interface{}{"key2": "value2"},
+		"key3": map[KeyString]interface{}{"key4": "value4"},
+	})
+	newPmap := PmapWithNested(p, []KeyString{"key1", "key5", "key6"}, "value6")
+	assert.Equal(t, map[KeyString]interface{}{
+		"key1": map[KeyString]interface{}{
+			"key2": "value2",
+			"key5": map[KeyString]interface{}{"key6": "value6"},
+		},
+		"key3": map[KeyString]interface{}{"key4": "value4"},
+	}, PmapToMap(newPmap))
+	assert.Equal(t, map[KeyString]interface{}{
+		"key1": map[KeyString]interface{}{"key2": "value2"},
+		"key3": map[KeyString]interface{}{"key4": "value4"},
+	}, PmapToMap(p))
+	old, _ := PmapGetNested(p, []KeyString{"key3"})
+	shared, _ := PmapGetNested(newPmap, []KeyString{"key3"})
+	assert.Same(t, old, shared)
+}
+
+func Test_PmapWithoutNested(t *testing.T) {
+	p := NewPmap(map[KeyString]interface{}{
+		"key1": map[KeyString]interface{}{"key2": "value2", "key3": "value3"},
+	})
+	newPmap := PmapWithoutNested(p, []KeyString{"key1", "key2"})
+	assert.Equal(t, map[KeyString]interface{}{
+		"key1": map[KeyString]interface{}{"key3": "value3"},
+	}, PmapToMap(newPmap))
+	assert.Equal(t, map[KeyString]interface{}{
+		"key1": map[KeyString]interface{}{"key2": "value2", "key3": "value3"},
+	}, PmapToMap(p))
+	assert.Same(t, newPmap, PmapWithoutNested(newPmap, []KeyString{"key1", "key4"}))
+}
+
+func Test_Pmap_ManyKeys(t *testing.T) {
+	m := map[KeyString]interface{}{}
+	p := NewPmap(nil)
+	for i := 0; i < 10000; i++ {
+		key := KeyString(fmt.Sprint(i))
+		m[key] = i
+		p = PmapWithNested(p, []KeyString{key}, i)
+	}
+	full := p
+	for i := 0; i < 10000; i += 2 {
+		key := KeyString(fmt.Sprint(i))
+		delete(m, key)
+		p = PmapWithoutNested(p, []KeyString{key})
+	}
+	assert.Equal(t, 5000, PmapLen(p))
+	assert.Equal(t, m, PmapToMap(p))
+	assert.Equal(t, 10000, PmapLen(full))
+	for i := 0; i < 10000; i++ {
+		value, found := PmapGetNested(full, []KeyString{KeyString(fmt.Sprint(i))})
+		assert.True(t, found)
+		assert.Equal(t, i, value)
+	}
+}
@@ -0,0 +1,50 @@
+package transfig
+
+import "sort"
+
+// Merge deeply merges `m` into the state, as a single Batch. Nested maps in
+// `m` are merged into the maps found at the same path in the state, and every
+// other value in `m` replaces the one in the state. Values in the state that
+// are not in `m` are kept. Only subscriptions to the values that actually
+// changed are notified.
+func (s *State) Merge(m map[KeyString]interface{}) error {
+	return s.commitFrom(func(values *pmap) []mutation {
+		return mergeMutations(values, Path{}, m)
+	})
+}
+
+// mergeMutations returns the mutations that merge `m` into the map found at
+// `path` in `values`, in key order.
+func mergeMutations(values *pmap, path Path, m map[KeyString]interface{}) []mutation {
+	keys := make([]KeyString, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	mutations := []mutation{}
+	for _, key := range keys {
+		value := m[key]
+		keyPath := append(append(Path{}, path...), key)
+		valueAsMap, isMap := value.(map[KeyString]interface{})
+		if !isMap {
+			mutations = append(mutations, mutation{op: OpSet, path: keyPath, value: value})
+			continue
+		}
+		current, _ := pmapGetNested(values, keyPath)
+		if _, currentIsMap := current.(*pmap); !currentIsMap {
+			mutations = append(mutations, mutation{op: OpSet, path: keyPath, value: value})
+			continue
+		}
+		mutations = append(mutations, mergeMutations(values, keyPath, valueAsMap)...)
+	}
+	return mutations
+}
+
+// Replace replaces the state values with `m`, as a single Batch. Only the
+// paths whose values differ are set or cleared, so only subscriptions to the
+// values that actually changed are notified.
+func (s *State) Replace(m map[KeyString]interface{}) error {
+	return s.commitFrom(func(values *pmap) []mutation {
+		return changeMutations(mapDiff(Path{}, values.toMap(), m))
+	})
+}
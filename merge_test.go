@@ -0,0 +1,156 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_Merge(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	state.SetNested(Path{Job, Compensation, Ammount}, 1000)
+
+	err := state.Merge(map[KeyString]interface{}{
+		Name: "Mike",
+		Job: map[KeyString]interface{}{
+			Compensation: map[KeyString]interface{}{Ammount: 2000},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, CallbackArgs{
+		Name: "Mike",
+		Age:  30,
+		Job: map[KeyString]interface{}{
+			Title:        "Developer",
+			Compensation: map[KeyString]interface{}{Ammount: 2000},
+		},
+	}, state.AsMap())
+}
+
+func Test_Merge_ReplacesNonMap(t *testing.T) {
+	state := DefaultState()
+	state.Set(Job, "Developer")
+	err := state.Merge(map[KeyString]interface{}{Job: map[KeyString]interface{}{Title: "Developer"}})
+	assert.NoError(t, err)
+	value, _ := state.Get(Job)
+	assert.Equal(t, map[KeyString]interface{}{Title: "Developer"}, value)
+}
+
+func Test_Merge_OnlyChangedKeysNotify(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	calls := map[string]int{}
+	subscribe := func(name string, keys ...KeyString) {
+		state.Subscribe(NewSubscription(name).WithNested(keys...).Calls(func(CallbackArgs) { calls[name]++ }))
+	}
+	subscribe("name", Name)
+	subscribe("age", Age)
+	subscribe("title", Job, Title)
+	subscribe("ammount", Job, Compensation, Ammount)
+
+	err := state.Merge(map[KeyString]interface{}{
+		Name: "John",
+		Age:  31,
+		Job: map[KeyString]interface{}{
+			Title:        "Developer",
+			Compensation: map[KeyString]interface{}{Ammount: 1000},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"age": 1, "ammount": 1}, calls)
+}
+
+func Test_Merge_ChangesInKeyOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		state := DefaultState()
+		state.SetNested(Path{Job, Title}, "Developer")
+		var paths []Path
+		state.Subscribe(NewSubscription("subName").With(Wildcard{}).CallsWithEvent(func(e ChangeEvent) {
+			for _, c := range e.Changes {
+				paths = append(paths, c.Path)
+			}
+		}))
+		err := state.Merge(map[KeyString]interface{}{
+			Name: "Mike",
+			Age:  31,
+			Job: map[KeyString]interface{}{
+				Title:        "Manager",
+				Compensation: map[KeyString]interface{}{Ammount: 1000},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []Path{{Age}, {Job, Compensation}, {Job, Title}, {Name}}, paths)
+	}
+}
+
+func Test_Replace(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	state.SetNested(Path{Job, Compensation, Ammount}, 1000)
+	calls := map[string]int{}
+	subscribe := func(name string, keys ...KeyString) {
+		state.Subscribe(NewSubscription(name).WithNested(keys...).Calls(func(CallbackArgs) { calls[name]++ }))
+	}
+	subscribe("name", Name)
+	subscribe("age", Age)
+	subscribe("title", Job, Title)
+	subscribe("ammount", Job, Compensation, Ammount)
+
+	newValues := map[KeyString]interface{}{
+		Name: "John",
+		Job: map[KeyString]interface{}{
+			Title:        "Developer",
+			Compensation: map[KeyString]interface{}{Ammount: 2000},
+		},
+	}
+	err := state.Replace(newValues)
+
+	assert.NoError(t, err)
+	assert.Equal(t, CallbackArgs(newValues), state.AsMap())
+	assert.Equal(t, map[string]int{"age": 1, "ammount": 1}, calls)
+}
+
+func Test_Replace_MapWithNonMap(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	err := state.Replace(map[KeyString]interface{}{Job: "Developer"})
+	assert.NoError(t, err)
+	assert.Equal(t, CallbackArgs{Job: "Developer"}, state.AsMap())
+}
+
+// writeOnce returns a middleware that calls `write` the first time a change
+// goes through it, as a concurrent writer would between the time a change is
+// computed and the time it is applied.
+func writeOnce(write func()) Middleware {
+	written := false
+	return func(next ChangeHandler) ChangeHandler {
+		return func(c Change) error {
+			if !written {
+				written = true
+				write()
+			}
+			return next(c)
+		}
+	}
+}
+
+func Test_Merge_ConcurrentWrite(t *testing.T) {
+	state := DefaultState()
+	state.Use(writeOnce(func() { state.SetNested(Path{Job, Compensation}, 1000) }))
+	assert.NoError(t, state.Merge(map[KeyString]interface{}{
+		Job: map[KeyString]interface{}{Title: "Developer"},
+	}))
+	job, _ := state.Get(Job)
+	assert.Equal(t, map[KeyString]interface{}{Title: "Developer", Compensation: 1000}, job)
+}
+
+func Test_Replace_ConcurrentWrite(t *testing.T) {
+	state := DefaultState()
+	state.Use(writeOnce(func() { state.Set(Job, "Developer") }))
+	assert.NoError(t, state.Replace(map[KeyString]interface{}{Name: "Mike"}))
+	assert.Equal(t, CallbackArgs{Name: "Mike"}, state.AsMap())
+}
@@ -0,0 +1,84 @@
+package transfig
+
+// ChangeHandler handles a change that is about to be made to the state
+type ChangeHandler func(Change) error
+
+// Middleware wraps the handling of every change made to the state. It
+// receives the next handler in the chain and returns a handler that may
+// inspect the change, modify it before passing it to `next`, or reject it by
+// returning an error without calling `next`.
+//
+// The changes seen by middlewares carry the value found at the path when the
+// change was requested in OldValue and Existed, and the requested value in
+// NewValue. Changes made by Undo, Redo and derived values don't go through
+// the middlewares. The changes of a Merge or a Replace are computed from the
+// current values, and computed and passed through the middlewares again if
+// the values change before they are applied.
+type Middleware func(next ChangeHandler) ChangeHandler
+
+// Use adds a middleware to the state. Middlewares are called in the order
+// they were added, the first one being the outermost.
+func (s *State) Use(middleware Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middlewares = append(s.middlewares, middleware)
+}
+
+// TrySet is like Set, but returns the error if the change is rejected
+func (s *State) TrySet(key KeyString, value interface{}) error {
+	return s.TrySetNested(Path{key}, value)
+}
+
+// TrySetNested is like SetNested, but returns the error if the change is
+// rejected
+func (s *State) TrySetNested(path Path, value interface{}) error {
+	return s.commit([]mutation{{op: OpSet, path: path, value: value}})
+}
+
+// TryClearNested is like ClearNested, but returns the error if the change is
+// rejected
+func (s *State) TryClearNested(path Path) error {
+	return s.commit([]mutation{{op: OpClear, path: path}})
+}
+
+// intercept passes mutations through the middlewares and returns the
+// mutations they let through, or the first error returned by them.
+func (s *State) intercept(mutations []mutation) ([]mutation, error) {
+	s.mu.RLock()
+	middlewares := s.middlewares
+	changes := make([]Change, 0, len(mutations))
+	if len(middlewares) > 0 {
+		for _, m := range mutations {
+			oldValue, found := pmapGetNested(s.values, m.path)
+			changes = append(changes, Change{
+				Op:       m.op,
+				Path:     m.path,
+				OldValue: valueCopy(oldValue),
+				NewValue: m.value,
+				Existed:  found,
+			})
+		}
+	}
+	s.mu.RUnlock()
+	if len(middlewares) == 0 {
+		return mutations, nil
+	}
+	result := make([]mutation, 0, len(mutations))
+	var require requirement
+	var handler ChangeHandler = func(c Change) error {
+		m := c.mutation()
+		m.require = require
+		result = append(result, m)
+		return nil
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	for i, c := range changes {
+		require = mutations[i].require
+		if err := handler(c); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package transfig_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+var errRejected = errors.New("rejected")
+
+func rejectAge(next ChangeHandler) ChangeHandler {
+	return func(c Change) error {
+		if (Path{Age}).Contains(c.Path) {
+			return errRejected
+		}
+		return next(c)
+	}
+}
+
+func Test_Middleware_Reject(t *testing.T) {
+	state := DefaultState()
+	state.Use(rejectAge)
+	callCount := 0
+	state.Subscribe(NewSubscription("subName").With(Age).Calls(func(CallbackArgs) { callCount++ }))
+
+	err := state.TrySet(Age, 40)
+	assert.ErrorIs(t, err, errRejected)
+	state.ClearNested(Path{Age})
+	value, _ := state.Get(Age)
+	assert.Equal(t, 30, value)
+	assert.Equal(t, 0, callCount)
+
+	assert.NoError(t, state.TrySet(Name, "Mike"))
+}
+
+func Test_Middleware_Modify(t *testing.T) {
+	state := DefaultState()
+	state.Use(func(next ChangeHandler) ChangeHandler {
+		return func(c Change) error {
+			if name, ok := c.NewValue.(string); ok {
+				c.NewValue = strings.ToUpper(name)
+			}
+			return next(c)
+		}
+	})
+	state.Set(Name, "Mike")
+	value, _ := state.Get(Name)
+	assert.Equal(t, "MIKE", value)
+}
+
+func Test_Middleware_ReceivesOldValue(t *testing.T) {
+	state := DefaultState()
+	changes := []Change{}
+	state.Use(func(next ChangeHandler) ChangeHandler {
+		return func(c Change) error {
+			changes = append(changes, c)
+			return next(c)
+		}
+	})
+	state.Set(Name, "Mike")
+	state.ClearNested(Path{Age})
+	assert.Equal(t, []Change{
+		{Op: OpSet, Path: Path{Name}, OldValue: "John", NewValue: "Mike", Existed: true},
+		{Op: OpClear, Path: Path{Age}, OldValue: 30, Existed: true},
+	}, changes)
+}
+
+func Test_Middleware_Order(t *testing.T) {
+	state := DefaultState()
+	calls := []string{}
+	named := func(name string) Middleware {
+		return func(next ChangeHandler) ChangeHandler {
+			return func(c Change) error {
+				calls = append(calls, name)
+				return next(c)
+			}
+		}
+	}
+	state.Use(named("first"))
+	state.Use(named("second"))
+	state.Set(Name, "Mike")
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func Test_Middleware_RejectRollsBackBatch(t *testing.T) {
+	state := DefaultState()
+	state.Use(rejectAge)
+	err := state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "Mike")
+		tx.Set(Age, 40)
+		return nil
+	})
+	assert.ErrorIs(t, err, errRejected)
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
@@ -0,0 +1,170 @@
+package transfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// OpKind is the kind of operation made on the state
+type OpKind int
+
+const (
+	// OpSet is a SetNested (or Set) operation
+	OpSet OpKind = iota
+	// OpClear is a ClearNested operation
+	OpClear
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpSet:
+		return "set"
+	case OpClear:
+		return "clear"
+	}
+	return "unknown"
+}
+
+// Change describes a single change made to the state
+type Change struct {
+	Op   OpKind
+	Path Path
+	// OldValue is the value found at Path before the change, if Existed.
+	OldValue interface{}
+	// NewValue is the value at Path after the change. Always nil for OpClear.
+	NewValue interface{}
+	// Existed is true if Path had a value before the change.
+	Existed bool
+}
+
+// mutation returns the mutation that produces the change
+func (c Change) mutation() mutation {
+	return mutation{op: c.Op, path: c.Path, value: c.NewValue}
+}
+
+// copy returns a copy of the change that shares no maps with the state
+func (c Change) copy() Change {
+	c.OldValue = valueCopy(c.OldValue)
+	c.NewValue = valueCopy(c.NewValue)
+	return c
+}
+
+// mutation is a single change to be applied to the state values
+type mutation struct {
+	op      OpKind
+	path    Path
+	value   interface{}
+	require requirement
+}
+
+// requirement is a precondition of a mutation on the values it is applied to
+type requirement int
+
+const (
+	requireNothing requirement = iota
+	// requireTarget requires a value at the path
+	requireTarget
+	// requireParent requires a map at the parent of the path
+	requireParent
+)
+
+// check returns an error if `values` don't meet the mutation requirement
+func (m mutation) check(values *pmap) error {
+	switch m.require {
+	case requireTarget:
+		if _, found := pmapGetNested(values, m.path); !found {
+			return fmt.Errorf("%w: %s", ErrPathNotFound, pathString(m.path))
+		}
+	case requireParent:
+		if len(m.path) > 1 {
+			parent, _ := pmapGetNested(values, m.path[:len(m.path)-1])
+			if _, isMap := parent.(*pmap); !isMap {
+				return fmt.Errorf("%w: %s", ErrPathNotFound, pathString(m.path[:len(m.path)-1]))
+			}
+		}
+	}
+	return nil
+}
+
+// applied is a mutation that was applied to the state values
+type applied struct {
+	Change
+	// revert is the mutation that restores the values as they were before.
+	// It may target an ancestor of `Path`, when the mutation created or
+	// replaced intermediate maps.
+	revert mutation
+}
+
+// apply applies the mutation to `values` and returns the new values and what
+// was applied. `values` is not modified (see pmap). The boolean is false if
+// nothing actually changed, in which case `values` is returned. The values of
+// the applied change are stored values, so pmaps rather than maps, and must
+// be copied before being handed over.
+func (m mutation) apply(values *pmap) (*pmap, applied, bool) {
+	if len(m.path) == 0 {
+		return values, applied{}, false
+	}
+	oldValue, found := pmapGetNested(values, m.path)
+	a := applied{Change: Change{Op: m.op, Path: m.path, OldValue: oldValue, Existed: found}}
+	switch m.op {
+	case OpSet:
+		if found && valueEqual(oldValue, m.value) {
+			return values, applied{}, false
+		}
+		a.NewValue = storedValue(m.value)
+		a.revert = revertFor(values, m.path)
+		values = pmapWithNested(values, m.path, a.NewValue)
+	case OpClear:
+		if !found {
+			return values, applied{}, false
+		}
+		a.revert = mutation{op: OpSet, path: m.path, value: oldValue}
+		values = pmapWithoutNested(values, m.path)
+	}
+	return values, a, true
+}
+
+// valueEqual returns true if the values are deeply equal, comparing pmaps as
+// maps
+func valueEqual(a, b interface{}) bool {
+	if pa, ok := a.(*pmap); ok {
+		if pb, ok := b.(*pmap); ok && pa == pb {
+			return true
+		}
+	}
+	return reflect.DeepEqual(plainValue(a), plainValue(b))
+}
+
+// revertFor returns the mutation that restores `values` after setting `path`.
+// Setting a path replaces the first ancestor that is missing or is not a map,
+// so that's the path the revert needs to restore.
+func revertFor(values *pmap, path Path) mutation {
+	for i := 1; i <= len(path); i++ {
+		v, found := pmapGetNested(values, path[:i])
+		if !found {
+			return mutation{op: OpClear, path: path[:i]}
+		}
+		if _, isMap := v.(*pmap); !isMap || i == len(path) {
+			return mutation{op: OpSet, path: path[:i], value: v}
+		}
+	}
+	return mutation{op: OpClear, path: path}
+}
+
+// applyAll applies all mutations to `values` and returns the new values and
+// what was applied for the mutations that actually changed something. Returns
+// an error if a mutation requirement is not met.
+func applyAll(values *pmap, mutations []mutation) (*pmap, []applied, error) {
+	changes := []applied{}
+	for _, m := range mutations {
+		if err := m.check(values); err != nil {
+			return nil, nil, err
+		}
+		var a applied
+		var changed bool
+		if values, a, changed = m.apply(values); changed {
+			changes = append(changes, a)
+		}
+	}
+	return values, changes, nil
+}
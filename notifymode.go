@@ -0,0 +1,43 @@
+package transfig
+
+// NotifyMode decides when a subscription is notified
+type NotifyMode int
+
+const (
+	// NotifyDefault uses the State's notify mode. As a State mode, it is the
+	// same as NotifyOnMatch.
+	NotifyDefault NotifyMode = iota
+	// NotifyOnMatch notifies a subscription whenever a path it is subscribed
+	// to is changed, even if the values it selects end up the same.
+	NotifyOnMatch
+	// NotifyOnValueChange notifies a subscription only if the values it
+	// selects are different after the change.
+	NotifyOnValueChange
+)
+
+// WithNotifyMode sets the notify mode of the subscription, overriding the one
+// of the State.
+func (s *Subscription) WithNotifyMode(mode NotifyMode) *Subscription {
+	s.mode = mode
+	return s
+}
+
+// SetNotifyMode sets the notify mode used by all subscriptions that don't
+// set their own.
+func (s *State) SetNotifyMode(mode NotifyMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifyMode = mode
+}
+
+// notifyModeOf returns the effective notify mode of a subscription. Must be
+// called with the lock held.
+func (s *State) notifyModeOf(sub *Subscription) NotifyMode {
+	if sub.mode != NotifyDefault {
+		return sub.mode
+	}
+	if s.notifyMode != NotifyDefault {
+		return s.notifyMode
+	}
+	return NotifyOnMatch
+}
@@ -0,0 +1,69 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_NotifyMode_OnMatchIsDefault(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	callCount := 0
+	sub := NewSubscription("subName").WithNested(Job, Title).Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	state.Set(Job, map[KeyString]interface{}{Title: "Developer", Compensation: 1000})
+	assert.Equal(t, 1, callCount)
+}
+
+func Test_NotifyMode_OnValueChangeSkipsUnchanged(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	callCount := 0
+	sub := NewSubscription("subName").
+		WithNested(Job, Title).
+		WithNotifyMode(NotifyOnValueChange).
+		Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+
+	state.Set(Job, map[KeyString]interface{}{Title: "Developer", Compensation: 1000})
+	assert.Equal(t, 0, callCount)
+
+	state.Set(Job, map[KeyString]interface{}{Title: "Manager"})
+	assert.Equal(t, 1, callCount)
+}
+
+func Test_NotifyMode_StateMode(t *testing.T) {
+	state := DefaultState()
+	state.SetNotifyMode(NotifyOnValueChange)
+	state.SetNested(Path{Job, Title}, "Developer")
+	defaultCount := 0
+	overrideCount := 0
+	state.Subscribe(NewSubscription("default").WithNested(Job, Title).Calls(func(CallbackArgs) { defaultCount++ }))
+	state.Subscribe(NewSubscription("override").
+		WithNested(Job, Title).
+		WithNotifyMode(NotifyOnMatch).
+		Calls(func(CallbackArgs) { overrideCount++ }))
+
+	state.SetNested(Path{Job}, map[KeyString]interface{}{Title: "Developer", Compensation: 1000})
+
+	assert.Equal(t, 0, defaultCount)
+	assert.Equal(t, 1, overrideCount)
+}
+
+func Test_NotifyMode_OnValueChangeBatch(t *testing.T) {
+	state := DefaultState()
+	callCount := 0
+	sub := NewSubscription("subName").
+		With(Name).
+		WithNotifyMode(NotifyOnValueChange).
+		Calls(func(CallbackArgs) { callCount++ })
+	state.Subscribe(sub)
+	_ = state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "Mike")
+		tx.Set(Name, "John")
+		return nil
+	})
+	assert.Equal(t, 0, callCount)
+}
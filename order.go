@@ -0,0 +1,57 @@
+package transfig
+
+import "sort"
+
+// Phase groups subscriptions that are notified before or after the others
+type Phase int
+
+const (
+	// PhaseBefore subscriptions are notified before all others, e.g. the
+	// ones validating or logging a change before it is acted upon. Like any
+	// mutation made by a callback, the ones they make are only applied once
+	// every subscription affected by the current change was notified, so
+	// the later phases are notified with the values before them, and then
+	// notified again. Values that must be up to date for the later phases
+	// should be kept with State.Derive instead.
+	PhaseBefore Phase = iota - 1
+	// PhaseDefault is the phase of subscriptions that don't set one
+	PhaseDefault
+	// PhaseAfter subscriptions are notified after all others, e.g. the ones
+	// rendering the state.
+	PhaseAfter
+)
+
+// InPhase sets the phase in which the subscription is notified
+func (s *Subscription) InPhase(phase Phase) *Subscription {
+	s.phase = phase
+	return s
+}
+
+// WithPriority sets the priority of the subscription. Within a phase,
+// subscriptions with a higher priority are notified first. The default
+// priority is zero.
+func (s *Subscription) WithPriority(priority int) *Subscription {
+	s.priority = priority
+	return s
+}
+
+// ordered returns the subscriptions in the order they must be notified: by
+// phase, then by decreasing priority, then in the order they were subscribed.
+// Must be called with the lock held.
+func (s *State) ordered(subs map[*Subscription]bool) []*Subscription {
+	result := make([]*Subscription, 0, len(subs))
+	for sub := range subs {
+		result = append(result, sub)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.phase != b.phase {
+			return a.phase < b.phase
+		}
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return s.subscriptions[a].id < s.subscriptions[b].id
+	})
+	return result
+}
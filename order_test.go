@@ -0,0 +1,68 @@
+package transfig_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_Order_RegistrationOrder(t *testing.T) {
+	state := DefaultState()
+	calls := []string{}
+	expected := []string{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprint("sub", i)
+		expected = append(expected, name)
+		state.Subscribe(NewSubscription(name).With(Name).Calls(func(CallbackArgs) { calls = append(calls, name) }))
+	}
+	for i := 0; i < 5; i++ {
+		calls = []string{}
+		state.Set(Name, fmt.Sprint(i))
+		assert.Equal(t, expected, calls)
+	}
+}
+
+func Test_Order_PhasesAndPriorities(t *testing.T) {
+	state := DefaultState()
+	calls := []string{}
+	subscribe := func(name string, sub *Subscription) {
+		state.Subscribe(sub.With(Name).Calls(func(CallbackArgs) { calls = append(calls, name) }))
+	}
+	subscribe("render", NewSubscription("render").InPhase(PhaseAfter))
+	subscribe("low", NewSubscription("low").WithPriority(-1))
+	subscribe("default", NewSubscription("default"))
+	subscribe("high", NewSubscription("high").WithPriority(10))
+	subscribe("derive", NewSubscription("derive").InPhase(PhaseBefore))
+	subscribe("render-first", NewSubscription("render-first").InPhase(PhaseAfter).WithPriority(1))
+	state.Set(Name, "Mike")
+	assert.Equal(t, []string{"derive", "high", "default", "low", "render-first", "render"}, calls)
+}
+
+func Test_Order_BeforePhaseMutationsAppliedAfterRound(t *testing.T) {
+	state := DefaultState()
+	Greeting := KeyString("greeting")
+	state.Subscribe(NewSubscription("greet").With(Name).InPhase(PhaseBefore).Calls(func(args CallbackArgs) {
+		state.Set(Greeting, "Hello "+args[Name].(string))
+	}))
+	assert.NoError(t, state.Derive(Path{Title}, []Selector{Name}, func(args CallbackArgs) interface{} {
+		return "Mr. " + args[Name].(string)
+	}))
+	rendered := []string{}
+	state.Subscribe(NewSubscription("render").With(Name).With(Greeting).InPhase(PhaseAfter).Calls(func(args CallbackArgs) {
+		greeting, _ := args[Greeting].(string)
+		title, _ := state.Get(Title)
+		rendered = append(rendered, fmt.Sprintf("%s/%s", greeting, title))
+	}))
+	state.Set(Name, "Mike")
+	assert.Equal(t, []string{"/Mr. Mike", "Hello Mike/Mr. Mike"}, rendered)
+}
+
+func Test_Order_Subscriptions(t *testing.T) {
+	state := DefaultState()
+	state.Subscribe(NewSubscription("render").With(Name).InPhase(PhaseAfter).WithPriority(2))
+	infos := state.Subscriptions()
+	assert.Equal(t, PhaseAfter, infos[0].Phase)
+	assert.Equal(t, 2, infos[0].Priority)
+}
@@ -0,0 +1,67 @@
+// Package config loads transfig states from configuration files, so that a
+// State can be used as the live configuration of an application.
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// Decoder decodes the contents of a configuration file into the nested maps
+// used by a State.
+type Decoder func(data []byte) (map[KeyString]interface{}, error)
+
+// Load creates a new state from the contents of `r`, decoded by `decode`
+func Load(r io.Reader, decode Decoder) (*State, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewStateFromMap(values), nil
+}
+
+// LoadFile creates a new state from the file at `path`, decoded by `decode`
+func LoadFile(path string, decode Decoder) (*State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := Load(f, decode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// MergeFile decodes the file at `path` with `decode` and merges it into `s`
+// with State.Merge, so that only subscriptions to the values that changed are
+// notified.
+func MergeFile(s *State, path string, decode Decoder) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return s.Merge(values)
+}
+
+// LoadYAML creates a new state from a YAML document read from `r`
+func LoadYAML(r io.Reader) (*State, error) {
+	return Load(r, DecodeYAML)
+}
+
+// LoadTOML creates a new state from a TOML document read from `r`
+func LoadTOML(r io.Reader) (*State, error) {
+	return Load(r, DecodeTOML)
+}
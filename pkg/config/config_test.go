@@ -0,0 +1,64 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func Test_LoadYAML(t *testing.T) {
+	state, err := LoadYAML(strings.NewReader("name: John\njob:\n  title: Developer\n"))
+	assert.NoError(t, err)
+	value, _ := state.GetNested("job", "title")
+	assert.Equal(t, "Developer", value)
+}
+
+func Test_LoadTOML(t *testing.T) {
+	state, err := LoadTOML(strings.NewReader("name = \"John\"\n[job]\ntitle = \"Developer\"\n"))
+	assert.NoError(t, err)
+	value, _ := state.GetNested("job", "title")
+	assert.Equal(t, "Developer", value)
+}
+
+func Test_LoadFile_ErrorHasFileName(t *testing.T) {
+	path := writeFile(t, "config.yaml", "name: [John\n")
+	_, err := LoadFile(path, DecodeYAML)
+	assert.ErrorContains(t, err, path)
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func Test_MergeFile(t *testing.T) {
+	state := NewStateFromMap(map[KeyString]interface{}{
+		"name": "John",
+		"job":  map[KeyString]interface{}{"title": "Developer", "level": 1},
+	})
+	calls := map[string]int{}
+	for _, key := range []KeyString{"name", "title", "level"} {
+		name := string(key)
+		path := Path{key}
+		if key != "name" {
+			path = Path{"job", key}
+		}
+		state.Subscribe(NewSubscription(name).With(path).Calls(func(CallbackArgs) { calls[name]++ }))
+	}
+	path := writeFile(t, "config.toml", "name = \"John\"\n[job]\nlevel = 2\n")
+
+	assert.NoError(t, MergeFile(state, path, DecodeTOML))
+
+	assert.Equal(t, CallbackArgs{
+		"name": "John",
+		"job":  map[KeyString]interface{}{"title": "Developer", "level": 2},
+	}, state.AsMap())
+	assert.Equal(t, map[string]int{"level": 1}, calls)
+}
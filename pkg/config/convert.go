@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// fieldAt returns the field of `schema` at `path`, or nil if there is none
+func fieldAt(schema Schema, path Path) *Field {
+	var field *Field
+	for _, key := range path {
+		if schema == nil {
+			return nil
+		}
+		field = schema[key]
+		if field == nil {
+			return nil
+		}
+		schema = field.Fields
+	}
+	return field
+}
+
+// fromString converts `raw` into the type declared by `schema` at `path`. If
+// `schema` is nil, or declares no type for `path`, `raw` is returned as is.
+func fromString(path Path, raw string, schema Schema) (interface{}, error) {
+	if schema == nil {
+		return raw, nil
+	}
+	field := fieldAt(schema, path)
+	if field == nil {
+		return nil, &ValidationError{Path: path, Reason: "unknown key"}
+	}
+	if field.Type == nil {
+		return raw, nil
+	}
+	value, err := parse(raw, field.Type)
+	if err != nil {
+		return nil, &ValidationError{Path: path, Reason: err.Error()}
+	}
+	return value, nil
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+)
+
+// parse parses `raw` into a value of type `t`
+func parse(raw string, t reflect.Type) (interface{}, error) {
+	value := reflect.New(t).Elem()
+	switch {
+	case t == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, err
+		}
+		value.SetInt(int64(d))
+	case t == timeType:
+		tm, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, err
+		}
+		value.Set(reflect.ValueOf(tm))
+	case t.Kind() == reflect.String:
+		value.SetString(raw)
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		value.SetBool(b)
+	case value.CanInt():
+		i, err := strconv.ParseInt(raw, 10, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		value.SetInt(i)
+	case value.CanUint():
+		u, err := strconv.ParseUint(raw, 10, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		value.SetUint(u)
+	case value.CanFloat():
+		f, err := strconv.ParseFloat(raw, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		value.SetFloat(f)
+	case t.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(raw), "["):
+		// Comma separated values
+		parts := strings.Split(raw, ",")
+		slice := reflect.MakeSlice(t, 0, len(parts))
+		for _, part := range parts {
+			elem, err := parse(strings.TrimSpace(part), t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			slice = reflect.Append(slice, reflect.ValueOf(elem))
+		}
+		value.Set(slice)
+	default:
+		if err := json.Unmarshal([]byte(raw), value.Addr().Interface()); err != nil {
+			return nil, fmt.Errorf("can't parse %q as %s: %w", raw, t, err)
+		}
+	}
+	return value.Interface(), nil
+}
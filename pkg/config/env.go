@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// Env maps environment variables to paths of a State. With the prefix
+// "APP_" and the default separator and key function, `APP_JOB__TITLE` maps to
+// Path{"job", "title"}.
+type Env struct {
+	// Prefix is the prefix of the variables to use. Other variables are
+	// ignored. The prefix is not part of the path.
+	Prefix string
+	// Separator separates the keys of the path in the variable names.
+	// Defaults to "__".
+	Separator string
+	// KeyFunc converts each part of a variable name into a key. Defaults to
+	// converting it to lower case.
+	KeyFunc func(string) KeyString
+	// Environ returns the environment as "KEY=value" strings. Defaults to
+	// os.Environ.
+	Environ func() []string
+}
+
+// Path returns the path for a variable name. The boolean is false if the
+// variable does not have the prefix.
+func (e Env) Path(name string) (Path, bool) {
+	if !strings.HasPrefix(name, e.Prefix) || len(name) == len(e.Prefix) {
+		return nil, false
+	}
+	separator := e.Separator
+	if separator == "" {
+		separator = "__"
+	}
+	keyFunc := e.KeyFunc
+	if keyFunc == nil {
+		keyFunc = func(s string) KeyString { return KeyString(strings.ToLower(s)) }
+	}
+	path := Path{}
+	for _, part := range strings.Split(strings.TrimPrefix(name, e.Prefix), separator) {
+		path = append(path, keyFunc(part))
+	}
+	return path, true
+}
+
+// Values returns the values of all environment variables with the prefix, as
+// nested maps. Values are converted to the type declared at their path by
+// `schema`, if not nil, and a ValidationError is returned if that fails or if
+// the path is not in `schema`.
+func (e Env) Values(schema Schema) (map[KeyString]interface{}, error) {
+	environ := e.Environ
+	if environ == nil {
+		environ = os.Environ
+	}
+	values := make(map[KeyString]interface{})
+	for _, kv := range environ() {
+		name, raw, _ := strings.Cut(kv, "=")
+		path, ok := e.Path(name)
+		if !ok {
+			continue
+		}
+		value, err := fromString(path, raw, schema)
+		if err != nil {
+			return nil, err
+		}
+		setNested(values, path, value)
+	}
+	return values, nil
+}
+
+// setNested sets a nested value in a map, creating the maps in between
+func setNested(m map[KeyString]interface{}, path Path, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[KeyString]interface{})
+		if !ok {
+			next = make(map[KeyString]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
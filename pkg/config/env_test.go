@@ -0,0 +1,86 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+func environ(vars ...string) func() []string {
+	return func() []string { return vars }
+}
+
+func appSchema() Schema {
+	return Schema{
+		"name": {Type: reflect.TypeFor[string]()},
+		"job": {Fields: Schema{
+			"title":   {Type: reflect.TypeFor[string]()},
+			"level":   {Type: reflect.TypeFor[int]()},
+			"remote":  {Type: reflect.TypeFor[bool]()},
+			"timeout": {Type: reflect.TypeFor[time.Duration]()},
+			"tags":    {Type: reflect.TypeFor[[]string]()},
+		}},
+	}
+}
+
+func Test_Env_Path(t *testing.T) {
+	env := Env{Prefix: "APP_"}
+	path, ok := env.Path("APP_JOB__TITLE")
+	assert.True(t, ok)
+	assert.Equal(t, Path{"job", "title"}, path)
+	_, ok = env.Path("OTHER_JOB")
+	assert.False(t, ok)
+	_, ok = env.Path("APP_")
+	assert.False(t, ok)
+}
+
+func Test_Env_PathCustom(t *testing.T) {
+	env := Env{Prefix: "X-", Separator: "-", KeyFunc: func(s string) KeyString { return KeyString(strings.ToUpper(s)) }}
+	path, ok := env.Path("X-job-title")
+	assert.True(t, ok)
+	assert.Equal(t, Path{"JOB", "TITLE"}, path)
+}
+
+func Test_Env_ValuesWithoutSchema(t *testing.T) {
+	env := Env{Prefix: "APP_", Environ: environ("APP_NAME=John", "APP_JOB__LEVEL=2", "HOME=/root")}
+	values, err := env.Values(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{
+		"name": "John",
+		"job":  map[KeyString]interface{}{"level": "2"},
+	}, values)
+}
+
+func Test_Env_ValuesWithSchema(t *testing.T) {
+	env := Env{Prefix: "APP_", Environ: environ(
+		"APP_JOB__LEVEL=2",
+		"APP_JOB__REMOTE=true",
+		"APP_JOB__TIMEOUT=1m",
+		"APP_JOB__TAGS=a, b",
+	)}
+	values, err := env.Values(appSchema())
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{
+		"job": map[KeyString]interface{}{
+			"level":   2,
+			"remote":  true,
+			"timeout": time.Minute,
+			"tags":    []string{"a", "b"},
+		},
+	}, values)
+}
+
+func Test_Env_ValuesInvalid(t *testing.T) {
+	env := Env{Prefix: "APP_", Environ: environ("APP_JOB__LEVEL=high")}
+	_, err := env.Values(appSchema())
+	assert.ErrorContains(t, err, "invalid value at 'job.level'")
+
+	env = Env{Prefix: "APP_", Environ: environ("APP_AGE=30")}
+	_, err = env.Values(appSchema())
+	assert.EqualError(t, err, "invalid value at 'age': unknown key")
+}
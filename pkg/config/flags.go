@@ -0,0 +1,58 @@
+package config
+
+import (
+	"flag"
+	"strings"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// Flags maps the flags of a flag.FlagSet to paths of a State. With the
+// default separator, the flag `-job.title` maps to Path{"job", "title"}.
+type Flags struct {
+	// Separator separates the keys of the path in the flag names. Defaults
+	// to ".".
+	Separator string
+}
+
+// Path returns the path for a flag name
+func (f Flags) Path(name string) Path {
+	separator := f.Separator
+	if separator == "" {
+		separator = "."
+	}
+	path := Path{}
+	for _, part := range strings.Split(name, separator) {
+		path = append(path, KeyString(part))
+	}
+	return path
+}
+
+// Values returns the values of the flags that were set in `fs`, as nested
+// maps. Flags that were not set are ignored, so that their defaults don't
+// override values from other sources. Values are converted to the type
+// declared at their path by `schema`, if not nil, and a ValidationError is
+// returned if that fails or if the path is not in `schema`. Without a schema,
+// flags implementing flag.Getter keep the type of their value, and other
+// flags are used as strings.
+func (f Flags) Values(fs *flag.FlagSet, schema Schema) (map[KeyString]interface{}, error) {
+	values := make(map[KeyString]interface{})
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		path := f.Path(fl.Name)
+		var value interface{}
+		if getter, ok := fl.Value.(flag.Getter); ok && schema == nil {
+			value = getter.Get()
+		} else if value, err = fromString(path, fl.Value.String(), schema); err != nil {
+			return
+		}
+		setNested(values, path, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
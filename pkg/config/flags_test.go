@@ -0,0 +1,38 @@
+package config_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+func flagSet(t *testing.T, args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("name", "Default", "")
+	fs.String("job.title", "", "")
+	fs.Int("job.level", 1, "")
+	assert.NoError(t, fs.Parse(args))
+	return fs
+}
+
+func Test_Flags_OnlySetFlags(t *testing.T) {
+	values, err := Flags{}.Values(flagSet(t, "-job.level", "3"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{"job": map[KeyString]interface{}{"level": 3}}, values)
+}
+
+func Test_Flags_WithSchema(t *testing.T) {
+	values, err := Flags{}.Values(flagSet(t, "-job.level", "3", "-name", "Mike"), appSchema())
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{
+		"name": "Mike",
+		"job":  map[KeyString]interface{}{"level": 3},
+	}, values)
+}
+
+func Test_Flags_CustomSeparator(t *testing.T) {
+	assert.Equal(t, Path{"job", "title"}, Flags{Separator: "-"}.Path("job-title"))
+}
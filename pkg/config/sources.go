@@ -0,0 +1,141 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"sync"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// Sources loads values into a State from several named sources, such as
+// defaults, a file, the environment and flags, and remembers which source
+// provided each value. Sources are applied in the order they are added, so
+// each one takes precedence over the ones added before it.
+type Sources struct {
+	mu    sync.Mutex
+	state *State
+	names []string
+	// origins has the same tree as the values provided by the sources, with
+	// the name of the source at every leaf.
+	origins map[KeyString]interface{}
+}
+
+// NewSources creates a new Sources that loads values into `s`
+func NewSources(s *State) *Sources {
+	return &Sources{state: s, origins: make(map[KeyString]interface{})}
+}
+
+// State returns the state the sources are loaded into
+func (src *Sources) State() *State {
+	return src.state
+}
+
+// Add merges `values` into the state with State.Merge and records `name` as
+// the source of all of them.
+func (src *Sources) Add(name string, values map[KeyString]interface{}) error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if err := src.state.Merge(values); err != nil {
+		return err
+	}
+	src.names = append(src.names, name)
+	recordOrigins(src.origins, values, name)
+	return nil
+}
+
+// AddFile adds the values in the file at `path`, decoded with `decode`
+func (src *Sources) AddFile(name string, path string, decode Decoder) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values, err := decode(data)
+	if err != nil {
+		return err
+	}
+	return src.Add(name, values)
+}
+
+// AddEnv adds the values of the environment variables selected by `env`,
+// converted to the types declared by the state's schema, if any.
+func (src *Sources) AddEnv(name string, env Env) error {
+	values, err := env.Values(src.state.Schema())
+	if err != nil {
+		return err
+	}
+	return src.Add(name, values)
+}
+
+// AddFlags adds the values of the flags set in `fs`, converted to the types
+// declared by the state's schema, if any.
+func (src *Sources) AddFlags(name string, fs *flag.FlagSet, flags Flags) error {
+	values, err := flags.Values(fs, src.state.Schema())
+	if err != nil {
+		return err
+	}
+	return src.Add(name, values)
+}
+
+// Order returns the names of the sources, from the lowest to the highest
+// precedence.
+func (src *Sources) Order() []string {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return append([]string{}, src.names...)
+}
+
+// SourceOf returns the name of the source that provided the value at `path`.
+// The boolean is false if no source provided it, or if `path` holds a map
+// whose values were provided by more than one source.
+func (src *Sources) SourceOf(path Path) (string, bool) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	var node interface{} = src.origins
+	for _, key := range path {
+		nodeAsMap, ok := node.(map[KeyString]interface{})
+		if !ok {
+			break
+		}
+		if node, ok = nodeAsMap[key]; !ok {
+			return "", false
+		}
+	}
+	return singleOrigin(node)
+}
+
+// singleOrigin returns the source of all the leaves under `node`, if they all
+// have the same one.
+func singleOrigin(node interface{}) (string, bool) {
+	nodeAsMap, ok := node.(map[KeyString]interface{})
+	if !ok {
+		name, ok := node.(string)
+		return name, ok
+	}
+	origin := ""
+	for _, child := range nodeAsMap {
+		name, ok := singleOrigin(child)
+		if !ok || (origin != "" && name != origin) {
+			return "", false
+		}
+		origin = name
+	}
+	return origin, origin != ""
+}
+
+// recordOrigins records `name` as the origin of every leaf in `values`
+func recordOrigins(origins map[KeyString]interface{}, values map[KeyString]interface{}, name string) {
+	for key, value := range values {
+		valueAsMap, isMap := value.(map[KeyString]interface{})
+		if !isMap || len(valueAsMap) == 0 {
+			origins[key] = name
+			continue
+		}
+		nested, ok := origins[key].(map[KeyString]interface{})
+		if !ok {
+			nested = make(map[KeyString]interface{})
+			origins[key] = nested
+		}
+		recordOrigins(nested, valueAsMap, name)
+	}
+}
@@ -0,0 +1,72 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+func Test_Sources_Precedence(t *testing.T) {
+	state := NewState()
+	assert.NoError(t, state.SetSchema(appSchema()))
+	src := NewSources(state)
+
+	assert.NoError(t, src.Add("defaults", map[KeyString]interface{}{
+		"name": "Default",
+		"job":  map[KeyString]interface{}{"title": "Developer", "level": 1, "remote": false},
+	}))
+	path := writeFile(t, "config.yaml", "job:\n  level: 2\n  remote: true\n")
+	assert.NoError(t, src.AddFile("file", path, DecodeYAML))
+	assert.NoError(t, src.AddEnv("env", Env{Prefix: "APP_", Environ: environ("APP_JOB__LEVEL=3")}))
+	assert.NoError(t, src.AddFlags("flags", flagSet(t, "-name", "Mike"), Flags{}))
+
+	assert.Equal(t, CallbackArgs{
+		"name": "Mike",
+		"job":  map[KeyString]interface{}{"title": "Developer", "level": 3, "remote": true},
+	}, state.AsMap())
+	assert.Equal(t, []string{"defaults", "file", "env", "flags"}, src.Order())
+
+	for name, keys := range map[string]Path{
+		"flags":    {"name"},
+		"defaults": {"job", "title"},
+		"env":      {"job", "level"},
+		"file":     {"job", "remote"},
+	} {
+		source, found := src.SourceOf(keys)
+		assert.True(t, found)
+		assert.Equal(t, name, source)
+	}
+}
+
+func Test_Sources_SourceOf(t *testing.T) {
+	src := NewSources(NewState())
+	assert.NoError(t, src.Add("defaults", map[KeyString]interface{}{
+		"job": map[KeyString]interface{}{"title": "Developer", "level": 1},
+	}))
+
+	source, found := src.SourceOf(Path{"job"})
+	assert.True(t, found)
+	assert.Equal(t, "defaults", source)
+
+	assert.NoError(t, src.Add("env", map[KeyString]interface{}{
+		"job": map[KeyString]interface{}{"level": 2},
+	}))
+	_, found = src.SourceOf(Path{"job"})
+	assert.False(t, found)
+	_, found = src.SourceOf(Path{"name"})
+	assert.False(t, found)
+	source, found = src.SourceOf(Path{"job", "level"})
+	assert.True(t, found)
+	assert.Equal(t, "env", source)
+}
+
+func Test_Sources_RejectedValues(t *testing.T) {
+	state := NewState()
+	assert.NoError(t, state.SetSchema(appSchema()))
+	src := NewSources(state)
+	err := src.Add("defaults", map[KeyString]interface{}{"age": 1})
+	assert.Error(t, err)
+	assert.Empty(t, src.Order())
+}
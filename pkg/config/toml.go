@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	. "github.com/vitorqb/transfig"
+)
+
+// DecodeTOML is a Decoder for TOML documents. Tables are decoded as nested
+// maps and integers as int. Errors report the line where they happened.
+func DecodeTOML(data []byte) (map[KeyString]interface{}, error) {
+	var value map[string]interface{}
+	if _, err := toml.Decode(string(data), &value); err != nil {
+		return nil, fmt.Errorf("can't decode TOML: %w", err)
+	}
+	values, _ := fromTOML(value).(map[KeyString]interface{})
+	if values == nil {
+		values = make(map[KeyString]interface{})
+	}
+	return values, nil
+}
+
+// fromTOML converts a value decoded by the toml package into the values used
+// by the state.
+func fromTOML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[KeyString]interface{}, len(v))
+		for key, nested := range v {
+			m[KeyString(key)] = fromTOML(nested)
+		}
+		return m
+	case []map[string]interface{}:
+		s := make([]interface{}, len(v))
+		for i, nested := range v {
+			s[i] = fromTOML(nested)
+		}
+		return s
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = fromTOML(nested)
+		}
+		return v
+	case int64:
+		return int(v)
+	}
+	return value
+}
@@ -0,0 +1,46 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+func Test_DecodeTOML(t *testing.T) {
+	values, err := DecodeTOML([]byte(`
+name = "John"
+age = 30
+height = 1.8
+
+[job]
+title = "Developer"
+tags = ["a", "b"]
+
+[[job.postings]]
+ammount = 10
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{
+		"name":   "John",
+		"age":    30,
+		"height": 1.8,
+		"job": map[KeyString]interface{}{
+			"title":    "Developer",
+			"tags":     []interface{}{"a", "b"},
+			"postings": []interface{}{map[KeyString]interface{}{"ammount": 10}},
+		},
+	}, values)
+}
+
+func Test_DecodeTOML_Empty(t *testing.T) {
+	values, err := DecodeTOML([]byte(""))
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{}, values)
+}
+
+func Test_DecodeTOML_SyntaxErrorReportsLine(t *testing.T) {
+	_, err := DecodeTOML([]byte("name = \"John\"\n[job]\ntitle = \"Developer\" x\n"))
+	assert.ErrorContains(t, err, "line 3")
+}
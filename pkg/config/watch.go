@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/vitorqb/transfig"
+)
+
+// DefaultWatchInterval is the interval used by a Watcher without one
+const DefaultWatchInterval = time.Second
+
+// Watcher keeps a State in sync with a configuration file by polling it for
+// changes.
+type Watcher struct {
+	// Interval is how often the file is checked for changes. Defaults to
+	// DefaultWatchInterval.
+	Interval time.Duration
+	// OnError is called when the file can't be read or decoded, or when the
+	// new values are rejected by the State. The State is left as it was.
+	OnError func(err error)
+}
+
+// Watch loads the file at `path` into `s` right away, and then again every
+// time the file's modification time or size changes, until `ctx` is done.
+// The file is decoded with `decode` and applied with State.Replace, so only
+// the paths that changed are set or cleared, and only the subscriptions to
+// them are notified. Watch blocks until `ctx` is done and returns its error.
+func (w *Watcher) Watch(ctx context.Context, s *State, path string, decode Decoder) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastModTime time.Time
+	lastSize := int64(-1)
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			w.report(err)
+		} else if !info.ModTime().Equal(lastModTime) || info.Size() != lastSize {
+			lastModTime, lastSize = info.ModTime(), info.Size()
+			if err := reload(s, path, decode); err != nil {
+				w.report(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) report(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// reload replaces the values of `s` with the ones in the file at `path`
+func reload(s *State, path string, decode Decoder) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return s.Replace(values)
+}
+
+// Watch starts watching the file at `path` in the background, as in
+// Watcher.Watch with the default interval, until `ctx` is done. Errors are
+// sent to the returned channel, which is closed when `ctx` is done. Errors
+// that arrive while the previous one was not received yet are dropped.
+func Watch(ctx context.Context, s *State, path string, decode Decoder) <-chan error {
+	errs := make(chan error, 1)
+	w := &Watcher{OnError: func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}}
+	go func() {
+		defer close(errs)
+		_ = w.Watch(ctx, s, path, decode)
+	}()
+	return errs
+}
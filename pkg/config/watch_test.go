@@ -0,0 +1,98 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+// rewrite writes a file with a new content and makes sure its modification
+// time changes, even on file systems with coarse timestamps.
+func rewrite(t *testing.T, path string, content string) {
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	modTime := info.ModTime().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func Test_Watcher_ReloadsOnChange(t *testing.T) {
+	path := writeFile(t, "config.yaml", "name: John\njob:\n  title: Developer\n")
+	state := NewState()
+	var mu sync.Mutex
+	calls := map[string]int{}
+	for _, key := range []KeyString{"name", "job"} {
+		name := string(key)
+		state.Subscribe(NewSubscription(name).With(key).Calls(func(CallbackArgs) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[name]++
+		}))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &Watcher{Interval: 5 * time.Millisecond}
+	go func() { _ = w.Watch(ctx, state, path, DecodeYAML) }()
+
+	assert.Eventually(t, func() bool {
+		value, _ := state.Get("name")
+		return value == "John"
+	}, time.Second, time.Millisecond)
+
+	rewrite(t, path, "name: John\njob:\n  title: Manager\n")
+
+	assert.Eventually(t, func() bool {
+		value, _ := state.GetNested("job", "title")
+		return value == "Manager"
+	}, time.Second, time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"name": 1, "job": 2}, calls)
+}
+
+func Test_Watcher_KeepsStateOnParseError(t *testing.T) {
+	path := writeFile(t, "config.yaml", "name: John\n")
+	state := NewState()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	w := &Watcher{Interval: 5 * time.Millisecond, OnError: func(err error) { errs <- err }}
+	done := make(chan error)
+	go func() { done <- w.Watch(ctx, state, path, DecodeYAML) }()
+
+	assert.Eventually(t, func() bool {
+		value, _ := state.Get("name")
+		return value == "John"
+	}, time.Second, time.Millisecond)
+
+	rewrite(t, path, "name: [Mike\n")
+
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, path)
+		assert.ErrorContains(t, err, "line 1")
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+	value, _ := state.Get("name")
+	assert.Equal(t, "John", value)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func Test_Watch_MissingFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := Watch(ctx, NewState(), "/does/not/exist.yaml", DecodeYAML)
+	err := <-errs
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	cancel()
+	for range errs {
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+
+	. "github.com/vitorqb/transfig"
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeYAML is a Decoder for YAML documents. The document must be a mapping
+// (or empty). Mappings are decoded as nested maps, with keys that are not
+// strings converted to strings. Errors report the line where they happened.
+func DecodeYAML(data []byte) (map[KeyString]interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("can't decode YAML: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return make(map[KeyString]interface{}), nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("can't decode YAML: line %d: expected a mapping at the top level", root.Line)
+	}
+	var value interface{}
+	if err := root.Decode(&value); err != nil {
+		return nil, fmt.Errorf("can't decode YAML: %w", err)
+	}
+	values, _ := fromYAML(value).(map[KeyString]interface{})
+	return values, nil
+}
+
+// fromYAML converts a value decoded by yaml.v3 into the values used by the
+// state.
+func fromYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[KeyString]interface{}, len(v))
+		for key, nested := range v {
+			m[KeyString(key)] = fromYAML(nested)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[KeyString]interface{}, len(v))
+		for key, nested := range v {
+			m[KeyString(fmt.Sprint(key))] = fromYAML(nested)
+		}
+		return m
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = fromYAML(nested)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,48 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/config"
+)
+
+func Test_DecodeYAML(t *testing.T) {
+	values, err := DecodeYAML([]byte(`
+name: John
+age: 30
+height: 1.8
+job:
+  title: Developer
+  tags: [a, b]
+  1: one
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{
+		"name":   "John",
+		"age":    30,
+		"height": 1.8,
+		"job": map[KeyString]interface{}{
+			"title": "Developer",
+			"tags":  []interface{}{"a", "b"},
+			"1":     "one",
+		},
+	}, values)
+}
+
+func Test_DecodeYAML_Empty(t *testing.T) {
+	values, err := DecodeYAML([]byte(""))
+	assert.NoError(t, err)
+	assert.Equal(t, map[KeyString]interface{}{}, values)
+}
+
+func Test_DecodeYAML_SyntaxErrorReportsLine(t *testing.T) {
+	_, err := DecodeYAML([]byte("name: John\njob:\n  title: a: b\n"))
+	assert.ErrorContains(t, err, "line 3")
+}
+
+func Test_DecodeYAML_NotAMapping(t *testing.T) {
+	_, err := DecodeYAML([]byte("\n- a\n- b\n"))
+	assert.EqualError(t, err, "can't decode YAML: line 2: expected a mapping at the top level")
+}
@@ -0,0 +1,291 @@
+// Package persist makes transfig states survive process restarts. Every change
+// to a State is appended to a write-ahead log, and the whole state is written
+// to a snapshot from time to time, after which the log is truncated.
+package persist
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/vitorqb/transfig"
+)
+
+const (
+	// SnapshotFile is the name of the snapshot file in the store directory
+	SnapshotFile = "snapshot.json"
+	// LogFile is the name of the write-ahead log file in the store directory
+	LogFile = "wal.log"
+)
+
+// SyncMode decides when the log file is synced to disk
+type SyncMode int
+
+const (
+	// SyncAlways syncs the log after every record, so that a change is on
+	// disk before the next one is written.
+	SyncAlways SyncMode = iota
+	// SyncInterval syncs the log when a record is written at least
+	// Options.SyncInterval after the last sync, and on Close.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system, except on Close.
+	SyncNever
+)
+
+// Options configure a Store
+type Options struct {
+	// Sync decides when the log is synced to disk. Defaults to SyncAlways.
+	Sync SyncMode
+	// SyncInterval is the minimum interval between syncs with SyncInterval.
+	SyncInterval time.Duration
+	// SnapshotEvery is the number of log records after which a snapshot is
+	// written and the log truncated. Snapshots are only written by
+	// Store.Snapshot if it is zero.
+	SnapshotEvery int
+	// OnError is called when a change can't be written to the log, or when
+	// an automatic snapshot can't be written. The state is not affected.
+	OnError func(err error)
+}
+
+// Store persists the changes of a State to a directory
+type Store struct {
+	state    *State
+	dir      string
+	options  Options
+	handle   SubscriptionHandle
+	mu       sync.Mutex
+	log      *os.File
+	records  int
+	lastSync time.Time
+	closed   bool
+}
+
+// Open restores `s` from the snapshot and log in `dir`, creating the
+// directory if needed, and then starts persisting every change to `s` in it
+// until the returned Store is closed.
+//
+// The snapshot, if any, replaces the values of `s`, as in State.UnmarshalJSON,
+// and the changes in the log are then applied in order. Values are decoded
+// guided by the schema of `s`, if any, in both cases. An incomplete or
+// corrupted last record, as left by a crash in the middle of a write, is
+// discarded and truncated from the log.
+func Open(dir string, s *State, options Options) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, SnapshotFile)); err == nil {
+		if err := s.UnmarshalJSON(data); err != nil {
+			return nil, fmt.Errorf("can't restore snapshot: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	log, err := os.OpenFile(filepath.Join(dir, LogFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	records, err := replay(log, s)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	store := &Store{
+		state:    s,
+		dir:      dir,
+		options:  options,
+		log:      log,
+		records:  records,
+		lastSync: time.Now(),
+	}
+	store.handle = s.Subscribe(NewSubscription("persist:" + dir).
+		With(Wildcard{}).
+		WithNotifyMode(NotifyOnMatch).
+		CallsWithEvent(store.write))
+	return store, nil
+}
+
+// replay applies to `s` the changes in the log, truncates an incomplete or
+// corrupted last record and leaves the log positioned at its end. Returns the
+// number of records in the log.
+func replay(log *os.File, s *State) (int, error) {
+	r := bufio.NewReader(log)
+	offset, records := int64(0), 0
+	for {
+		payload, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errBadRecord) {
+			if err := log.Truncate(offset); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		changes, err := ParseJSONPatchWithSchema(payload, s.Schema())
+		if err != nil {
+			return 0, fmt.Errorf("can't replay log record %d: %w", records+1, err)
+		}
+		if err := s.Apply(changes); err != nil {
+			return 0, fmt.Errorf("can't replay log record %d: %w", records+1, err)
+		}
+		offset += int64(recordHeaderSize + len(payload))
+		records++
+	}
+	_, err := log.Seek(offset, io.SeekStart)
+	return records, err
+}
+
+// write appends the changes of an event to the log
+func (st *Store) write(event ChangeEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return
+	}
+	if err := st.append(event.Changes); err != nil {
+		st.report(err)
+		return
+	}
+	if st.options.SnapshotEvery > 0 && st.records >= st.options.SnapshotEvery {
+		if err := st.snapshot(event.Snapshot); err != nil {
+			st.report(err)
+		}
+	}
+}
+
+// append writes a record with `changes` to the log and syncs it as
+// configured. Must be called with the lock held.
+func (st *Store) append(changes []Change) error {
+	payload, err := JSONPatch(changes)
+	if err != nil {
+		return err
+	}
+	if _, err := st.log.Write(appendRecord(nil, payload)); err != nil {
+		return fmt.Errorf("can't write to log: %w", err)
+	}
+	st.records++
+	switch st.options.Sync {
+	case SyncAlways:
+		return st.sync()
+	case SyncInterval:
+		if time.Since(st.lastSync) >= st.options.SyncInterval {
+			return st.sync()
+		}
+	}
+	return nil
+}
+
+// sync syncs the log to disk. Must be called with the lock held.
+func (st *Store) sync() error {
+	if err := st.log.Sync(); err != nil {
+		return fmt.Errorf("can't sync log: %w", err)
+	}
+	st.lastSync = time.Now()
+	return nil
+}
+
+// Snapshot writes the current values of the state to the snapshot file and
+// truncates the log.
+//
+// Changes made right before the call may still be written to the log after
+// it, and are then applied again on top of the snapshot when the state is
+// restored. Since every change sets or clears a path, that leaves the values
+// as they were.
+func (st *Store) Snapshot() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return os.ErrClosed
+	}
+	return st.snapshot(st.state.Snapshot())
+}
+
+// snapshot writes `sn` to the snapshot file and truncates the log. The
+// snapshot is written to a temporary file first and then renamed, so a crash
+// leaves either the old or the new snapshot, followed by a log that may
+// repeat changes already in it. Must be called with the lock held.
+func (st *Store) snapshot(sn Snapshot) error {
+	data, err := json.Marshal(sn.AsMap())
+	if err != nil {
+		return fmt.Errorf("can't write snapshot: %w", err)
+	}
+	path := filepath.Join(st.dir, SnapshotFile)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return fmt.Errorf("can't write snapshot: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("can't write snapshot: %w", err)
+	}
+	if err := syncDir(st.dir); err != nil {
+		return fmt.Errorf("can't write snapshot: %w", err)
+	}
+	if err := st.log.Truncate(0); err != nil {
+		return fmt.Errorf("can't truncate log: %w", err)
+	}
+	if _, err := st.log.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("can't truncate log: %w", err)
+	}
+	st.records = 0
+	return st.sync()
+}
+
+// Close waits until the changes made so far are written, stops persisting the
+// changes to the state, syncs the log and closes it. Changes made after Close
+// are not persisted.
+func (st *Store) Close() error {
+	st.state.Flush()
+	st.handle.Cancel()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return nil
+	}
+	st.closed = true
+	syncErr := st.sync()
+	if err := st.log.Close(); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+func (st *Store) report(err error) {
+	if st.options.OnError != nil {
+		st.options.OnError(err)
+	}
+}
+
+// writeFileSync writes `data` to the file at `path` and syncs it
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs a directory, so that a rename in it is on disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,180 @@
+package persist_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+	. "github.com/vitorqb/transfig/pkg/persist"
+)
+
+// restore opens a new state from `dir` and closes the store right away
+func restore(t *testing.T, dir string) *State {
+	state := NewState()
+	store, err := Open(dir, state, Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+	return state
+}
+
+func logSize(t *testing.T, dir string) int64 {
+	info, err := os.Stat(filepath.Join(dir, LogFile))
+	assert.NoError(t, err)
+	return info.Size()
+}
+
+func Test_Store_PersistsChanges(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	store, err := Open(dir, state, Options{})
+	assert.NoError(t, err)
+	state.Set("name", "John")
+	state.SetNested(Path{"job", "title"}, "Developer")
+	state.SetNested(Path{"job", "years"}, 3)
+	state.ClearNested(Path{"name"})
+	assert.NoError(t, store.Close())
+	state.Set("age", 30)
+
+	restored := restore(t, dir)
+	assert.Equal(t, CallbackArgs{"job": map[KeyString]interface{}{"title": "Developer", "years": 3}}, restored.AsMap())
+}
+
+func Test_Store_PersistsChangesWithSchema(t *testing.T) {
+	schema := Schema{
+		"ratio": {Type: reflect.TypeOf(0.0)},
+		"tags":  {Type: reflect.TypeOf([]string{})},
+	}
+	dir := t.TempDir()
+	state, err := NewStateFromMapWithSchema(map[KeyString]interface{}{}, schema)
+	assert.NoError(t, err)
+	store, err := Open(dir, state, Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, state.TrySet("ratio", 3.0))
+	assert.NoError(t, state.TrySet("tags", []string{"a", "b"}))
+	assert.NoError(t, store.Close())
+
+	restored, err := NewStateFromMapWithSchema(map[KeyString]interface{}{}, schema)
+	assert.NoError(t, err)
+	store, err = Open(dir, restored, Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+	assert.Equal(t, CallbackArgs{"ratio": 3.0, "tags": []string{"a", "b"}}, restored.AsMap())
+}
+
+func Test_Store_CloseWritesQueuedChanges(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	dispatcher := NewAsyncDispatcher(2)
+	defer dispatcher.Close()
+	state.SetDispatcher(dispatcher)
+	store, err := Open(dir, state, Options{Sync: SyncNever})
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		state.Set("count", i)
+	}
+	assert.NoError(t, store.Close())
+	count, _ := restore(t, dir).Get("count")
+	assert.Equal(t, 99, count)
+}
+
+func Test_Store_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	store, err := Open(dir, state, Options{})
+	assert.NoError(t, err)
+	state.Set("name", "John")
+	state.Set("age", 30)
+	assert.NoError(t, store.Snapshot())
+	assert.Equal(t, int64(0), logSize(t, dir))
+	state.Set("age", 31)
+	assert.NoError(t, store.Close())
+
+	restored := restore(t, dir)
+	assert.Equal(t, CallbackArgs{"name": "John", "age": 31}, restored.AsMap())
+}
+
+func Test_Store_SnapshotEvery(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	store, err := Open(dir, state, Options{SnapshotEvery: 3, Sync: SyncNever})
+	assert.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		state.Set("count", i)
+	}
+	assert.NoError(t, store.Close())
+	_, err = os.Stat(filepath.Join(dir, SnapshotFile))
+	assert.NoError(t, err)
+
+	restored := NewState()
+	store, err = Open(dir, restored, Options{SnapshotEvery: 3})
+	assert.NoError(t, err)
+	value, _ := restored.Get("count")
+	assert.Equal(t, 6, value)
+	restored.Set("count", 7)
+	assert.NoError(t, store.Close())
+	value, _ = restore(t, dir).Get("count")
+	assert.Equal(t, 7, value)
+}
+
+func Test_Store_RecoversFromTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	store, err := Open(dir, state, Options{})
+	assert.NoError(t, err)
+	state.Set("name", "John")
+	size := logSize(t, dir)
+	state.Set("name", "Mike")
+	assert.NoError(t, store.Close())
+	for _, truncateAt := range []int64{logSize(t, dir) - 1, size + 3} {
+		assert.NoError(t, os.Truncate(filepath.Join(dir, LogFile), truncateAt))
+		restored := restore(t, dir)
+		assert.Equal(t, CallbackArgs{"name": "John"}, restored.AsMap())
+		assert.Equal(t, size, logSize(t, dir))
+	}
+}
+
+func Test_Store_RecoversFromCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	store, err := Open(dir, state, Options{})
+	assert.NoError(t, err)
+	state.Set("name", "John")
+	size := logSize(t, dir)
+	state.Set("name", "Mike")
+	assert.NoError(t, store.Close())
+	path := filepath.Join(dir, LogFile)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-2] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	restored := NewState()
+	store, err = Open(dir, restored, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, CallbackArgs{"name": "John"}, restored.AsMap())
+	assert.Equal(t, size, logSize(t, dir))
+	restored.Set("age", 30)
+	assert.NoError(t, store.Close())
+	assert.Equal(t, CallbackArgs{"name": "John", "age": 30}, restore(t, dir).AsMap())
+}
+
+func Test_Store_InvalidSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, SnapshotFile), []byte("{"), 0o644))
+	_, err := Open(dir, NewState(), Options{})
+	assert.ErrorContains(t, err, "snapshot")
+}
+
+func Test_Store_SyncInterval(t *testing.T) {
+	dir := t.TempDir()
+	state := NewState()
+	store, err := Open(dir, state, Options{Sync: SyncInterval, SyncInterval: time.Hour})
+	assert.NoError(t, err)
+	state.Set("name", "John")
+	assert.NoError(t, store.Close())
+	assert.Equal(t, CallbackArgs{"name": "John"}, restore(t, dir).AsMap())
+}
@@ -0,0 +1,60 @@
+package persist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// recordHeaderSize is the size of the header of a log record: the length of
+// its payload followed by the CRC-32 of the payload, both as big endian
+// uint32.
+const recordHeaderSize = 8
+
+// maxRecordSize is the largest payload accepted when reading records. Larger
+// lengths can only come from a corrupted header.
+const maxRecordSize = 1 << 30
+
+// errBadRecord is returned by readRecord when a record is incomplete or its
+// checksum doesn't match.
+var errBadRecord = errors.New("bad log record")
+
+// appendRecord encodes `payload` as a log record and appends it to `buf`
+func appendRecord(buf []byte, payload []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	return append(buf, payload...)
+}
+
+// readRecord reads a log record from `r` and returns its payload. Returns
+// io.EOF if there are no more records, or errBadRecord if the record is
+// incomplete or corrupted.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, errBadRecord
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > maxRecordSize {
+		return nil, errBadRecord
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errBadRecord
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errBadRecord
+	}
+	return payload, nil
+}
@@ -13,6 +13,28 @@ const TransfigImportPath = "github.com/vitorqb/transfig"
 // GenNode represents a node in the state tree
 type GenNode map[string]interface{}
 
+// Schema returns a transfig Schema with the same tree as the node, to be used
+// to validate the values of the state wrapped by the generated code. Every
+// leaf becomes a field with the leaf's type.
+func (n GenNode) Schema() (Schema, error) {
+	schema := make(Schema)
+	for key, node := range n {
+		switch v := node.(type) {
+		case GenNode:
+			fields, err := v.Schema()
+			if err != nil {
+				return nil, err
+			}
+			schema[KeyString(key)] = &Field{Fields: fields}
+		case reflect.Type:
+			schema[KeyString(key)] = &Field{Type: v}
+		default:
+			return nil, fmt.Errorf("unkown value for node: %s", node)
+		}
+	}
+	return schema, nil
+}
+
 // StateGen generates code for a state that wraps an `State` object into a
 // struct with getters and setters for each nested object in the state tree.
 func StateGen(rootNode GenNode, packagePath string, filepath string) error {
@@ -96,3 +96,30 @@ func Test_ConstructorFromArgsFunc(t *testing.T) {
 	assert.Contains(t, result, "p := transfig.Path{}")
 	assert.Contains(t, result, "return &NewState{transfig.NewStateFromMap(args), p}")
 }
+
+func Test_GenNode_Schema(t *testing.T) {
+	node := GenNode{
+		"CurrentPhase": reflect.TypeFor[string](),
+		"Transaction": GenNode{
+			"Tags": reflect.SliceOf(reflect.TypeFor[string]()),
+		},
+	}
+	schema, err := node.Schema()
+	assert.NoError(t, err)
+	assert.Equal(t, Schema{
+		"CurrentPhase": &Field{Type: reflect.TypeFor[string]()},
+		"Transaction": &Field{Fields: Schema{
+			"Tags": &Field{Type: reflect.TypeFor[[]string]()},
+		}},
+	}, schema)
+
+	state := NewState()
+	assert.NoError(t, state.SetSchema(schema))
+	assert.NoError(t, state.TrySetNested(Path{"Transaction", "Tags"}, []string{"a"}))
+	assert.Error(t, state.TrySetNested(Path{"Transaction", "Tags"}, "a"))
+}
+
+func Test_GenNode_SchemaUnknownNode(t *testing.T) {
+	_, err := GenNode{"Foo": 1}.Schema()
+	assert.Error(t, err)
+}
@@ -0,0 +1,366 @@
+package transfig
+
+import (
+	"encoding/json"
+	"hash/maphash"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// pmap is a persistent map of KeyString to values, used for the state values
+// and every map nested in them. It is never modified: `with` and `without`
+// return a new map that shares almost all of its memory with the old one, so
+// changing a key costs in proportion to the logarithm of the size of the map,
+// not to the size itself, and an old version of the values (e.g. a Snapshot)
+// can be kept around for free. Nested maps are stored as *pmap and handed out
+// as map[KeyString]interface{} copies.
+//
+// It is a hash array mapped trie: each node holds up to 32 entries, indexed by
+// 5 bits of the hash of their key, that are either a key and its value or a
+// child node indexed by the next 5 bits. Keys whose hashes are equal end up in
+// a collision node, which is a plain list.
+type pmap struct {
+	root *pmapNode
+	size int
+
+	// plain caches the result of plainMap
+	plainOnce sync.Once
+	plain     map[KeyString]interface{}
+}
+
+type pmapNode struct {
+	bitmap  uint32
+	entries []pmapEntry
+}
+
+// pmapEntry is either a key and its value or, if child is not nil, a child
+// node
+type pmapEntry struct {
+	hash  uint64
+	key   KeyString
+	value interface{}
+	child *pmapNode
+}
+
+const (
+	pmapBits = 5
+	pmapMask = 1<<pmapBits - 1
+	// pmapMaxShift is the shift past which hashes have no bits left, and
+	// nodes are collision nodes
+	pmapMaxShift = 64
+)
+
+var pmapSeed = maphash.MakeSeed()
+
+func pmapHash(key KeyString) uint64 {
+	return maphash.String(pmapSeed, string(key))
+}
+
+// newPmap returns a pmap with the values of `m`, in which nested maps are
+// converted to pmaps as well
+func newPmap(m map[KeyString]interface{}) *pmap {
+	p := &pmap{}
+	for k, v := range m {
+		p = p.with(k, storedValue(v))
+	}
+	return p
+}
+
+// storedValue returns the value stored in the state for `v`: a pmap if it is
+// a map, or else a copy of it as in valueCopy. Pmaps are stored as they are.
+func storedValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case *pmap:
+		return vv
+	case map[KeyString]interface{}:
+		return newPmap(vv)
+	}
+	return valueCopy(v)
+}
+
+// plainValue returns `v`, or a copy of it as a map[KeyString]interface{} if it
+// is a pmap
+func plainValue(v interface{}) interface{} {
+	if p, ok := v.(*pmap); ok {
+		return p.toMap()
+	}
+	return v
+}
+
+// len returns the number of keys in the map
+func (p *pmap) len() int {
+	if p == nil {
+		return 0
+	}
+	return p.size
+}
+
+// get returns the value of `key`
+func (p *pmap) get(key KeyString) (interface{}, bool) {
+	if p == nil {
+		return nil, false
+	}
+	hash := pmapHash(key)
+	n := p.root
+	for shift := uint(0); n != nil; shift += pmapBits {
+		if shift >= pmapMaxShift {
+			for _, e := range n.entries {
+				if e.key == key {
+					return e.value, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << ((hash >> shift) & pmapMask)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		e := n.entries[bits.OnesCount32(n.bitmap&(bit-1))]
+		if e.child == nil {
+			if e.key == key {
+				return e.value, true
+			}
+			return nil, false
+		}
+		n = e.child
+	}
+	return nil, false
+}
+
+// with returns a copy of the map with `value` at `key`
+func (p *pmap) with(key KeyString, value interface{}) *pmap {
+	var root *pmapNode
+	size := 0
+	if p != nil {
+		root, size = p.root, p.size
+	}
+	root, added := root.with(pmapEntry{hash: pmapHash(key), key: key, value: value}, 0)
+	if added {
+		size++
+	}
+	return &pmap{root: root, size: size}
+}
+
+// without returns a copy of the map without `key`, or the map itself if it
+// does not have `key`
+func (p *pmap) without(key KeyString) *pmap {
+	if p == nil {
+		return p
+	}
+	root, removed := p.root.without(pmapHash(key), key, 0)
+	if !removed {
+		return p
+	}
+	return &pmap{root: root, size: p.size - 1}
+}
+
+// each calls `fn` with every key and value of the map, in no particular order
+func (p *pmap) each(fn func(key KeyString, value interface{})) {
+	if p != nil {
+		p.root.each(fn)
+	}
+}
+
+// toMap returns a copy of the map as a map[KeyString]interface{}, with all
+// nested values copied as in valueCopy
+func (p *pmap) toMap() map[KeyString]interface{} {
+	m := make(map[KeyString]interface{}, p.len())
+	p.each(func(key KeyString, value interface{}) {
+		m[key] = valueCopy(value)
+	})
+	return m
+}
+
+// plainMap returns the map as a map[KeyString]interface{}, converting it only
+// the first time. The result is shared and must not be modified.
+func (p *pmap) plainMap() map[KeyString]interface{} {
+	if p == nil {
+		return map[KeyString]interface{}{}
+	}
+	p.plainOnce.Do(func() { p.plain = p.toMap() })
+	return p.plain
+}
+
+// diffKeys returns the sorted keys whose values may differ between `p` and
+// `o`. The nodes shared by both maps are skipped.
+func (p *pmap) diffKeys(o *pmap) []KeyString {
+	var root, oRoot *pmapNode
+	if p != nil {
+		root = p.root
+	}
+	if o != nil {
+		oRoot = o.root
+	}
+	found := make(map[KeyString]bool)
+	root.diffKeys(oRoot, 0, found)
+	keys := make([]KeyString, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// MarshalJSON encodes the map as a JSON object
+func (p *pmap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.toMap())
+}
+
+// with returns a copy of the node with the `entry` leaf, and whether it added a
+// new key. `n` may be nil.
+func (n *pmapNode) with(entry pmapEntry, shift uint) (*pmapNode, bool) {
+	if n == nil {
+		n = &pmapNode{}
+	}
+	if shift >= pmapMaxShift {
+		for i, e := range n.entries {
+			if e.key == entry.key {
+				c := n.clone()
+				c.entries[i] = entry
+				return c, false
+			}
+		}
+		return &pmapNode{entries: append(n.clone().entries, entry)}, true
+	}
+	bit := uint32(1) << ((entry.hash >> shift) & pmapMask)
+	i := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		entries := make([]pmapEntry, len(n.entries)+1)
+		copy(entries, n.entries[:i])
+		entries[i] = entry
+		copy(entries[i+1:], n.entries[i:])
+		return &pmapNode{bitmap: n.bitmap | bit, entries: entries}, true
+	}
+	c := n.clone()
+	e := n.entries[i]
+	switch {
+	case e.child != nil:
+		child, added := e.child.with(entry, shift+pmapBits)
+		c.entries[i] = pmapEntry{child: child}
+		return c, added
+	case e.key == entry.key:
+		c.entries[i] = entry
+		return c, false
+	}
+	child, _ := (*pmapNode)(nil).with(e, shift+pmapBits)
+	child, _ = child.with(entry, shift+pmapBits)
+	c.entries[i] = pmapEntry{child: child}
+	return c, true
+}
+
+// without returns a copy of the node without `key`, or nil if it is left
+// empty, and whether the key was found
+func (n *pmapNode) without(hash uint64, key KeyString, shift uint) (*pmapNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	if shift >= pmapMaxShift {
+		for i, e := range n.entries {
+			if e.key == key {
+				return n.remove(i, 0), true
+			}
+		}
+		return n, false
+	}
+	bit := uint32(1) << ((hash >> shift) & pmapMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := bits.OnesCount32(n.bitmap & (bit - 1))
+	e := n.entries[i]
+	if e.child == nil {
+		if e.key != key {
+			return n, false
+		}
+		return n.remove(i, bit), true
+	}
+	child, removed := e.child.without(hash, key, shift+pmapBits)
+	if !removed {
+		return n, false
+	}
+	if child == nil {
+		return n.remove(i, bit), true
+	}
+	c := n.clone()
+	if len(child.entries) == 1 && child.entries[0].child == nil {
+		// A single key is kept in its parent, which is where it would have
+		// been if it had always been alone.
+		c.entries[i] = child.entries[0]
+	} else {
+		c.entries[i] = pmapEntry{child: child}
+	}
+	return c, true
+}
+
+// remove returns a copy of the node without its `i`-th entry, whose bit is
+// `bit`, or nil if it is left empty
+func (n *pmapNode) remove(i int, bit uint32) *pmapNode {
+	if len(n.entries) == 1 {
+		return nil
+	}
+	entries := make([]pmapEntry, 0, len(n.entries)-1)
+	entries = append(entries, n.entries[:i]...)
+	entries = append(entries, n.entries[i+1:]...)
+	return &pmapNode{bitmap: n.bitmap &^ bit, entries: entries}
+}
+
+func (n *pmapNode) clone() *pmapNode {
+	return &pmapNode{bitmap: n.bitmap, entries: append([]pmapEntry(nil), n.entries...)}
+}
+
+// diffKeys adds to `keys` the keys under `n` or `o` whose values may differ.
+// Either node may be nil.
+func (n *pmapNode) diffKeys(o *pmapNode, shift uint, keys map[KeyString]bool) {
+	if n == o {
+		return
+	}
+	add := func(key KeyString, _ interface{}) {
+		keys[key] = true
+	}
+	if n == nil || o == nil || shift >= pmapMaxShift {
+		n.each(add)
+		o.each(add)
+		return
+	}
+	for i := 0; i < 1<<pmapBits; i++ {
+		bit := uint32(1) << i
+		e, inN := n.entry(bit)
+		oe, inO := o.entry(bit)
+		if inN && inO && e.child != nil && oe.child != nil {
+			e.child.diffKeys(oe.child, shift+pmapBits, keys)
+			continue
+		}
+		if inN {
+			e.each(add)
+		}
+		if inO {
+			oe.each(add)
+		}
+	}
+}
+
+// entry returns the entry of the node at `bit`, if any
+func (n *pmapNode) entry(bit uint32) (pmapEntry, bool) {
+	if n.bitmap&bit == 0 {
+		return pmapEntry{}, false
+	}
+	return n.entries[bits.OnesCount32(n.bitmap&(bit-1))], true
+}
+
+func (e pmapEntry) each(fn func(key KeyString, value interface{})) {
+	if e.child != nil {
+		e.child.each(fn)
+	} else {
+		fn(e.key, e.value)
+	}
+}
+
+func (n *pmapNode) each(fn func(key KeyString, value interface{})) {
+	if n == nil {
+		return
+	}
+	for _, e := range n.entries {
+		e.each(fn)
+	}
+}
@@ -0,0 +1,238 @@
+package transfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Schema declares the keys allowed in a (possibly nested) map of the state
+// and the values allowed under each of them. Keys that are not in the schema
+// are not allowed.
+type Schema map[KeyString]*Field
+
+// Field declares the values allowed under a key of a Schema
+type Field struct {
+	// Type is the Go type of the value. If nil, any type is allowed.
+	Type reflect.Type
+	// Required fields can't be missing or cleared.
+	Required bool
+	// Enum, if not empty, lists all the allowed values.
+	Enum []interface{}
+	// Range, if not nil, is the range allowed for numeric values.
+	Range *Range
+	// Fields, if not nil, makes the value a nested map with the given schema.
+	// If both Type and Fields are nil, any value is allowed, including maps
+	// with any keys.
+	Fields Schema
+}
+
+// Range is an inclusive range of numbers
+type Range struct {
+	Min, Max float64
+}
+
+// ValidationError is returned when a value does not match a Schema
+type ValidationError struct {
+	Path   Path
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid value at %s: %s", pathString(e.Path), e.Reason)
+}
+
+func pathString(path Path) string {
+	keys := make([]string, 0, len(path))
+	for _, k := range path {
+		keys = append(keys, string(k))
+	}
+	return "'" + strings.Join(keys, ".") + "'"
+}
+
+func invalid(path Path, format string, args ...interface{}) error {
+	return &ValidationError{Path: append(Path{}, path...), Reason: fmt.Sprintf(format, args...)}
+}
+
+// Validate returns a ValidationError if `values` do not match the schema
+func (schema Schema) Validate(values map[KeyString]interface{}) error {
+	return schema.validateMap(Path{}, values)
+}
+
+func (schema Schema) validateMap(path Path, values map[KeyString]interface{}) error {
+	for key, value := range values {
+		field, found := schema[key]
+		if !found {
+			return invalid(append(path, key), "unknown key")
+		}
+		if err := field.validate(append(path, key), value); err != nil {
+			return err
+		}
+	}
+	return schema.validateRequired(path, func(key KeyString) bool {
+		_, found := values[key]
+		return found
+	})
+}
+
+// validateRequired checks that every required key is found by `has`
+func (schema Schema) validateRequired(path Path, has func(KeyString) bool) error {
+	for key, field := range schema {
+		if field.Required && !has(key) {
+			return invalid(append(path, key), "missing required key")
+		}
+	}
+	return nil
+}
+
+// fieldAt returns the field declared for the nested `path`, or nil if there
+// is none
+func (schema Schema) fieldAt(path Path) *Field {
+	var field *Field
+	for _, key := range path {
+		if field = schema[key]; field == nil {
+			return nil
+		}
+		schema = field.Fields
+	}
+	return field
+}
+
+// free returns true if the field allows any value
+func (f *Field) free() bool {
+	return f.Type == nil && f.Fields == nil
+}
+
+func (f *Field) validate(path Path, value interface{}) error {
+	if f.Fields != nil {
+		valueAsMap, ok := value.(map[KeyString]interface{})
+		if !ok {
+			return invalid(path, "expected a map, got %T", value)
+		}
+		return f.Fields.validateMap(path, valueAsMap)
+	}
+	if f.Type != nil {
+		if value == nil {
+			switch f.Type.Kind() {
+			case reflect.Interface, reflect.Map, reflect.Pointer, reflect.Slice:
+			default:
+				return invalid(path, "expected %s, got nil", f.Type)
+			}
+		} else if !reflect.TypeOf(value).AssignableTo(f.Type) {
+			return invalid(path, "expected %s, got %T", f.Type, value)
+		}
+	}
+	if len(f.Enum) > 0 {
+		allowed := false
+		for _, e := range f.Enum {
+			if reflect.DeepEqual(e, value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return invalid(path, "%v is not one of %v", value, f.Enum)
+		}
+	}
+	if f.Range != nil {
+		n, ok := asFloat(value)
+		if !ok {
+			return invalid(path, "expected a number, got %T", value)
+		}
+		if n < f.Range.Min || n > f.Range.Max {
+			return invalid(path, "%v is out of range [%v, %v]", value, f.Range.Min, f.Range.Max)
+		}
+	}
+	return nil
+}
+
+// asFloat converts any number to a float64
+func asFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// validateChange validates the values after a change was applied to them. It
+// checks the maps from the root down to the changed path and the value found
+// there, but not the maps beside them, which were already valid. If an
+// ancestor of the path is no longer a map, a later change of the same commit
+// removed or replaced it, and only that change is validated.
+func (schema Schema) validateChange(values *pmap, c Change) error {
+	fields := schema
+	current := values
+	has := func(key KeyString) bool {
+		_, found := current.get(key)
+		return found
+	}
+	for i, key := range c.Path {
+		if err := fields.validateRequired(c.Path[:i], has); err != nil {
+			return err
+		}
+		field, found := fields[key]
+		if !found {
+			return invalid(c.Path[:i+1], "unknown key")
+		}
+		if i == len(c.Path)-1 {
+			if value, found := current.get(key); found {
+				return field.validate(c.Path, plainValue(value))
+			}
+			return nil
+		}
+		if field.free() {
+			return nil
+		}
+		if field.Fields == nil {
+			return invalid(c.Path[:i+1], "expected %s, got a map", field.Type)
+		}
+		fields = field.Fields
+		value, _ := current.get(key)
+		next, ok := value.(*pmap)
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return nil
+}
+
+// SetSchema attaches a schema to the state. From then on, changes that would
+// make the state values not match the schema are rejected with a
+// ValidationError. Returns a ValidationError, and leaves the state as it was,
+// if the current values don't match the schema. A nil schema removes it.
+func (s *State) SetSchema(schema Schema) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if schema != nil {
+		if err := schema.Validate(s.values.toMap()); err != nil {
+			return err
+		}
+	}
+	s.schema = schema
+	return nil
+}
+
+// Schema returns the schema attached to the state, if any
+func (s *State) Schema() Schema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schema
+}
+
+// NewStateFromMapWithSchema creates a new state from a map, with the given
+// schema attached. Returns a ValidationError if the map does not match the
+// schema.
+func NewStateFromMapWithSchema(m map[KeyString]interface{}, schema Schema) (*State, error) {
+	s := NewStateFromMap(m)
+	if err := s.SetSchema(schema); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,123 @@
+package transfig_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func personSchema() Schema {
+	return Schema{
+		Name: {Type: reflect.TypeFor[string](), Required: true},
+		Age:  {Type: reflect.TypeFor[int](), Range: &Range{Min: 0, Max: 150}},
+		Job: {Fields: Schema{
+			Title:        {Type: reflect.TypeFor[string](), Enum: []interface{}{"Developer", "Manager"}},
+			Compensation: {},
+		}},
+	}
+}
+
+func Test_Schema_SetValid(t *testing.T) {
+	state := DefaultState()
+	assert.NoError(t, state.SetSchema(personSchema()))
+	assert.NoError(t, state.TrySet(Name, "Mike"))
+	assert.NoError(t, state.TrySetNested(Path{Job, Title}, "Manager"))
+	assert.NoError(t, state.TrySetNested(Path{Job, Compensation, Ammount}, 1000))
+	assert.NoError(t, state.TryClearNested(Path{Age}))
+}
+
+func Test_Schema_SetInvalid(t *testing.T) {
+	state := DefaultState()
+	assert.NoError(t, state.SetSchema(personSchema()))
+
+	var validationErr *ValidationError
+	err := state.TrySet(Age, "30")
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, Path{Age}, validationErr.Path)
+	assert.EqualError(t, err, "invalid value at 'age': expected int, got string")
+
+	assert.EqualError(t, state.TrySet(Age, 200), "invalid value at 'age': 200 is out of range [0, 150]")
+	assert.EqualError(t, state.TrySet(MissingKey, 1), "invalid value at 'missingKey': unknown key")
+	assert.EqualError(t, state.TryClearNested(Path{Name}), "invalid value at 'name': missing required key")
+	assert.EqualError(
+		t,
+		state.TrySetNested(Path{Job, Title}, "Intern"),
+		"invalid value at 'job.title': Intern is not one of [Developer Manager]",
+	)
+	assert.EqualError(t, state.TrySetNested(Path{Name, Title}, "x"), "invalid value at 'name': expected string, got a map")
+	assert.EqualError(t, state.TrySet(Job, "Developer"), "invalid value at 'job': expected a map, got string")
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
+
+func Test_Schema_InvalidBatchIsRolledBack(t *testing.T) {
+	state := DefaultState()
+	assert.NoError(t, state.SetSchema(personSchema()))
+	callCount := 0
+	state.Subscribe(NewSubscription("subName").With(Wildcard{}).Calls(func(CallbackArgs) { callCount++ }))
+	err := state.Batch(func(tx *Tx) error {
+		tx.Set(Name, "Mike")
+		tx.SetNested(Path{Job, Title}, "Developer")
+		tx.Set(Age, -1)
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, callCount)
+	assert.Equal(t, DefaultState().AsMap(), state.AsMap())
+}
+
+func Test_Schema_RequiredNested(t *testing.T) {
+	schema := Schema{
+		Job: {Fields: Schema{
+			Title:        {Type: reflect.TypeFor[string](), Required: true},
+			Compensation: {Type: reflect.TypeFor[int]()},
+		}},
+	}
+	state := NewState()
+	assert.NoError(t, state.SetSchema(schema))
+	assert.Error(t, state.TrySetNested(Path{Job, Compensation}, 1000))
+	assert.NoError(t, state.Batch(func(tx *Tx) error {
+		tx.SetNested(Path{Job, Title}, "Developer")
+		tx.SetNested(Path{Job, Compensation}, 1000)
+		return nil
+	}))
+}
+
+func Test_Schema_BatchClearsAncestorOfRequired(t *testing.T) {
+	schema := Schema{
+		Job: {Fields: Schema{
+			Title: {Type: reflect.TypeFor[string](), Required: true},
+		}},
+	}
+	state := NewState()
+	assert.NoError(t, state.SetSchema(schema))
+	assert.NoError(t, state.Batch(func(tx *Tx) error {
+		tx.SetNested(Path{Job, Title}, "Developer")
+		tx.ClearNested(Path{Job})
+		return nil
+	}))
+	assert.Equal(t, CallbackArgs{}, state.AsMap())
+	assert.Error(t, state.Batch(func(tx *Tx) error {
+		tx.ClearNested(Path{Job})
+		tx.SetNested(Path{Job, Title}, 1)
+		return nil
+	}))
+}
+
+func Test_Schema_SetSchemaValidatesCurrentValues(t *testing.T) {
+	state := DefaultState()
+	state.Set(Age, "thirty")
+	assert.Error(t, state.SetSchema(personSchema()))
+	assert.Nil(t, state.Schema())
+}
+
+func Test_NewStateFromMapWithSchema(t *testing.T) {
+	_, err := NewStateFromMapWithSchema(map[KeyString]interface{}{Age: 30}, personSchema())
+	assert.EqualError(t, err, "invalid value at 'name': missing required key")
+
+	state, err := NewStateFromMapWithSchema(map[KeyString]interface{}{Name: "John"}, personSchema())
+	assert.NoError(t, err)
+	value, _ := state.Get(Name)
+	assert.Equal(t, "John", value)
+}
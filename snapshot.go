@@ -0,0 +1,49 @@
+package transfig
+
+// Snapshot is an immutable view of the values of a State at some point in
+// time. Taking a snapshot is cheap: the state never modifies its values in
+// place, a mutation makes new persistent maps that share almost everything
+// with the old ones, so a snapshot simply keeps the values it was taken from.
+//
+// Snapshots are safe to read from any goroutine while the state keeps
+// changing. Values read from a snapshot are copies, so they can be modified
+// freely without affecting the snapshot or the state.
+type Snapshot struct {
+	values *pmap
+	seq    uint64
+}
+
+// Snapshot returns a snapshot of the current state values
+func (s *State) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Snapshot{values: s.values, seq: s.seq}
+}
+
+// Seq returns the sequence number of the last commit included in the snapshot
+func (sn Snapshot) Seq() uint64 {
+	return sn.seq
+}
+
+// Get returns the value for a specific key
+func (sn Snapshot) Get(key KeyString) (value interface{}, found bool) {
+	value, found = sn.values.get(key)
+	return valueCopy(value), found
+}
+
+// GetNested returns the value for a nested key
+func (sn Snapshot) GetNested(keys ...KeyString) (value interface{}, found bool) {
+	value, found = pmapGetNested(sn.values, keys)
+	return valueCopy(value), found
+}
+
+// Select returns the values selected by `selectors`, as they would be passed
+// to a subscription with the same selectors
+func (sn Snapshot) Select(selectors ...Selector) CallbackArgs {
+	return (&Subscription{selectors: selectors}).args(sn.values)
+}
+
+// AsMap returns a copy of the snapshot as a map
+func (sn Snapshot) AsMap() CallbackArgs {
+	return sn.values.toMap()
+}
@@ -0,0 +1,105 @@
+package transfig_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+func Test_Snapshot_UnaffectedByLaterChanges(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	snapshot := state.Snapshot()
+	state.Set(Name, "Mike")
+	state.SetNested(Path{Job, Title}, "Manager")
+	state.ClearNested(Path{Age})
+	name, _ := snapshot.Get(Name)
+	assert.Equal(t, "John", name)
+	title, _ := snapshot.GetNested(Job, Title)
+	assert.Equal(t, "Developer", title)
+	age, found := snapshot.Get(Age)
+	assert.True(t, found)
+	assert.Equal(t, 30, age)
+	title, _ = state.GetNested(Job, Title)
+	assert.Equal(t, "Manager", title)
+}
+
+func Test_Snapshot_ReadsAreCopies(t *testing.T) {
+	state := DefaultState()
+	state.Set(Job, map[KeyString]interface{}{Title: "Developer"})
+	state.Set(Ammount, []interface{}{1, 2})
+	snapshot := state.Snapshot()
+	job, _ := snapshot.Get(Job)
+	job.(map[KeyString]interface{})[Title] = "Manager"
+	snapshot.AsMap()[Ammount].([]interface{})[0] = 3
+	title, _ := snapshot.GetNested(Job, Title)
+	assert.Equal(t, "Developer", title)
+	ammount, _ := state.Get(Ammount)
+	assert.Equal(t, []interface{}{1, 2}, ammount)
+}
+
+func Test_Snapshot_Seq(t *testing.T) {
+	state := DefaultState()
+	before := state.Snapshot()
+	state.Set(Name, "Mike")
+	assert.Equal(t, before.Seq()+1, state.Snapshot().Seq())
+}
+
+func Test_Snapshot_Select(t *testing.T) {
+	state := DefaultState()
+	state.SetNested(Path{Job, Title}, "Developer")
+	assert.Equal(t, CallbackArgs{
+		Name: "John",
+		Job:  map[KeyString]interface{}{Title: "Developer"},
+	}, state.Snapshot().Select(Name, Path{Job, Title}))
+}
+
+func Test_Snapshot_InChangeEvent(t *testing.T) {
+	state := DefaultState()
+	var events []ChangeEvent
+	sub := NewSubscription("subName").With(Name).CallsWithEvent(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+	state.Subscribe(sub)
+	state.Set(Name, "Mike")
+	state.Set(Name, "Paul")
+	assert.Len(t, events, 2)
+	name, _ := events[0].Snapshot.Get(Name)
+	assert.Equal(t, "Mike", name)
+	age, _ := events[0].Snapshot.Get(Age)
+	assert.Equal(t, 30, age)
+	assert.Equal(t, events[0].Seq, events[0].Snapshot.Seq())
+}
+
+func Test_Snapshot_RejectedChangeLeavesValues(t *testing.T) {
+	state := DefaultState()
+	assert.NoError(t, state.SetSchema(personSchema()))
+	snapshot := state.Snapshot()
+	assert.Error(t, state.TrySet(Age, 200))
+	assert.Equal(t, snapshot.AsMap(), state.AsMap())
+	assert.Equal(t, snapshot.Seq(), state.Snapshot().Seq())
+}
+
+func Test_Concurrent_Snapshot(t *testing.T) {
+	state := DefaultState()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			state.SetNested(Path{Job, KeyString(fmt.Sprint(i % 10))}, i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			snapshot := state.Snapshot()
+			first := snapshot.AsMap()
+			assert.Equal(t, first, snapshot.AsMap())
+		}
+	}()
+	wg.Wait()
+}
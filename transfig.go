@@ -4,6 +4,8 @@ package transfig
 
 import (
 	"reflect"
+	"sync"
+	"sync/atomic"
 )
 
 // KeyValIter is an iterator for (key, value) pairs.
@@ -69,6 +71,19 @@ func (p Path) Contains(p2 Path) bool {
 	return true
 }
 
+// equal returns true if both paths have the same keys
+func (p Path) equal(p2 Path) bool {
+	if len(p) != len(p2) {
+		return false
+	}
+	for i := range p {
+		if p[i] != p2[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // StringKey is a string representing a specific key in the state. When used in
 // a subscription, it will add a `key: value` pair to the subscription's arguments,
 // where `key` is the string and `value` is the value in the state.
@@ -118,26 +133,44 @@ type SubscriptionCallback func(CallbackArgs)
 // Subscription represents a func that will be called when the state changes
 // for specific keys of the state.
 type Subscription struct {
+	// serial numbers the subscriptions in the order they are created, across
+	// all states. It only spreads them over the workers of an AsyncDispatcher
+	// and names watches; states order their subscriptions by registration.id.
+	serial    uint64
 	name      string
 	selectors []Selector
-	callbacks []SubscriptionCallback
+	callbacks []EventErrorCallback
+	mode      NotifyMode
+	// maxFailures is the number of consecutive failures after which the
+	// subscription is disabled, or zero if it is never disabled.
+	maxFailures int
+	phase       Phase
+	priority    int
+	// states are the states the subscription is subscribed to, which must
+	// index the selectors added to it later. Guarded by mu.
+	mu     sync.Mutex
+	states map[*State]bool
 }
 
-// With add keys selectors to the subscription
+// With add keys selectors to the subscription. Selectors added once the
+// subscription is subscribed apply from the next change on.
 func (s *Subscription) With(selector Selector) *Subscription {
 	s.selectors = append(s.selectors, selector)
+	s.reindex()
 	return s
 }
 
 // WithNested allows subscribing to nested values in the state
 func (s *Subscription) WithNested(keys ...KeyString) *Subscription {
-	s.selectors = append(s.selectors, Path(keys))
-	return s
+	return s.With(Path(keys))
 }
 
 // Calls adds a function to be called when the state changes
 func (s *Subscription) Calls(callback SubscriptionCallback) *Subscription {
-	s.callbacks = append(s.callbacks, callback)
+	s.callbacks = append(s.callbacks, func(event ChangeEvent) error {
+		callback(event.Args)
+		return nil
+	})
 	return s
 }
 
@@ -150,37 +183,133 @@ func (s *Subscription) subscribedTo(p Path) bool {
 	return false
 }
 
-// notify calls the subscription's callbacks with the subscribed values
-func (s *Subscription) notify(values map[KeyString]interface{}) {
-	args := make(CallbackArgs)
+// args builds the subscription's callback arguments from the state values.
+// The returned map shares nothing with `values`, so it is safe to hand it to
+// a callback after the state lock is released. The selectors of this package
+// read `values` directly, and any other selector is given a map with all of
+// them, converted once per version of the values.
+func (s *Subscription) args(values *pmap) CallbackArgs {
+	args := make(map[KeyString]interface{})
 	for _, selector := range s.selectors {
-		it := selector.Select(values)
+		if _, isWildcard := selector.(Wildcard); isWildcard {
+			values.each(func(key KeyString, value interface{}) {
+				args[key] = valueCopy(value)
+			})
+			continue
+		}
+		if path, ok := indexPath(selector); ok {
+			if len(path) > 0 {
+				args[path[0]] = pmapSelect(values, path)
+			}
+			continue
+		}
+		it := selector.Select(values.plainMap())
 		for {
 			key, value, finished := it()
 			if finished {
 				break
 			}
-			args[key] = value
+			args[key] = valueCopy(value)
 		}
 	}
+	return args
+}
+
+// notify calls the subscription's callbacks with the given event and returns
+// the errors they returned. A panic in a callback is recovered and returned
+// as a PanicError, and the remaining callbacks are still called.
+func (s *Subscription) notify(event ChangeEvent) []error {
+	errs := []error{}
 	for _, callback := range s.callbacks {
-		callback(args)
+		if err := call(callback, event); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errs
 }
 
 // NewSubscription creates a new subscription
 func NewSubscription(name string) *Subscription {
 	return &Subscription{
+		serial:    subscriptionSerials.Add(1),
 		name:      name,
-		callbacks: make([]SubscriptionCallback, 0),
+		callbacks: make([]EventErrorCallback, 0),
 	}
 }
 
+// subscriptionSerials generates the serial numbers of the subscriptions
+var subscriptionSerials atomic.Uint64
+
+// notification is a pending call to a subscription's callbacks
+type notification struct {
+	sub   *Subscription
+	event ChangeEvent
+	// chain holds the names of the subscriptions whose callbacks made the
+	// mutations that led to the notification, if any.
+	chain []string
+}
+
 // State represents a potentially nested key -> value state that can
 // be subscribed to and updated.
+//
+// State is safe for concurrent use. Reads only take a shared lock, so they do
+// not block each other. Mutations are applied atomically and the resulting
+// notifications are queued and delivered in the same order the mutations were
+// applied. The subscriptions affected by a mutation are notified in a
+// deterministic order: by phase, then by priority, then in the order they
+// were subscribed (see Subscription.InPhase and Subscription.WithPriority).
+// Callbacks are always called without holding the state lock, so they are
+// free to read from or write to the state.
+//
+// A mutation made while a callback is running is queued, and applied once all
+// the subscriptions affected by the current commit were notified, so that
+// they all see the same values. The method making it returns right away:
+// TrySet and the other methods returning an error return nil, Undo, Redo,
+// StepBack and StepForward return true, and the errors found when the
+// mutation is applied are reported to the OnError handler, as the callback
+// errors are. A cascade of such mutations is limited in depth (see
+// SetMaxCascadeDepth). The state can't tell which goroutine makes a
+// mutation, so mutations made by other goroutines while a callback is running
+// are queued as well, as if the callback made them. Callbacks are only known
+// to be running when notifications are delivered by SyncDispatcher, so
+// mutations made by callbacks run by an AsyncDispatcher are applied at once.
+//
+// A mutation returns once its notifications are delivered, unless
+// notifications are already being delivered by another goroutine. It then
+// returns right away, and its notifications are delivered after the ones
+// queued before it, by that goroutine or by one it hands them over to. Flush
+// waits for them. Notifications are delivered right away by default, and a
+// Dispatcher can be set to deliver them in the background instead.
+//
+// The state values are never modified in place. They are kept in persistent
+// maps (see pmap), so a mutation copies only a few small nodes along the
+// mutated path and shares everything else with the previous values. That
+// keeps writes cheap however large the state is, and it is what makes
+// Snapshot cheap.
 type State struct {
-	subscriptions map[string]*Subscription
-	values        map[KeyString]interface{}
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]*registration
+	names         map[string]map[*Subscription]bool
+	nextID        uint64
+	index         *subscriptionIndex
+	values        *pmap
+	pending       []notification
+	queued        uint64
+	dispatched    uint64
+	delivering    bool
+	delivered     chan struct{}
+	deferred      []deferredUpdate
+	dispatcher    Dispatcher
+	dispatching   *notification
+	maxCascade    int
+	onError       func(subName string, err error)
+	history       *history
+	derived       []*derived
+	middlewares   []Middleware
+	schema        Schema
+	actionLog     *actionLog
+	seq           uint64
+	notifyMode    NotifyMode
 }
 
 // Set updates the state with a new value for a specific key
@@ -190,81 +319,284 @@ func (s *State) Set(key KeyString, value interface{}) {
 
 // SetNested updates the state with a new value for a nested key
 func (s *State) SetNested(path Path, value interface{}) {
-	oldValue, found := mapGetNested(s.values, path)
-	if found && reflect.DeepEqual(oldValue, value) {
-		return
+	_ = s.TrySetNested(path, value)
+}
+
+// ClearNested removes a nested key from the state
+func (s *State) ClearNested(path Path) {
+	_ = s.TryClearNested(path)
+}
+
+// commit passes a sequence of mutations through the middlewares and then
+// atomically applies them and notifies, once, every subscription subscribed
+// to any of the paths that actually changed. If a middleware rejects any of
+// the mutations, or if they don't match the schema, nothing is applied and the
+// error is returned.
+func (s *State) commit(mutations []mutation) error {
+	return s.commitLabeled(mutations, "")
+}
+
+// commitLabeled is commit with the label recorded in the action log
+func (s *State) commitLabeled(mutations []mutation, label string) error {
+	return s.update(func(chain []string) error {
+		mutations, err := s.intercept(mutations)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.apply(mutations, label, chain)
+	})
+}
+
+// commitFrom is commit with mutations computed by `prepare` from the values
+// they are applied to. The mutations pass through the middlewares without the
+// lock held, so if the values changed in the meantime they are computed and
+// passed through the middlewares again.
+func (s *State) commitFrom(prepare func(values *pmap) []mutation) error {
+	return s.update(func(chain []string) error {
+		for {
+			s.mu.RLock()
+			values, seq := s.values, s.seq
+			s.mu.RUnlock()
+			mutations, err := s.intercept(prepare(values))
+			if err != nil {
+				return err
+			}
+			s.mu.Lock()
+			if s.seq != seq {
+				s.mu.Unlock()
+				continue
+			}
+			err = s.apply(mutations, "", chain)
+			s.mu.Unlock()
+			return err
+		}
+	})
+}
+
+// update calls `run`, which changes the state, delivers the resulting
+// notifications and returns the error of `run`. When called while a callback
+// is running (see nested), `run` is queued instead, to be called after the
+// notifications of the current commit are dispatched, with the cascade of
+// subscriptions that led to it, and nil is returned. The errors of queued
+// updates are reported as the errors of the callback that was running.
+func (s *State) update(run func(chain []string) error) error {
+	s.mu.Lock()
+	if s.nested() {
+		s.deferred = append(s.deferred, deferredUpdate{run: run, chain: s.cascade()})
+		s.mu.Unlock()
+		return nil
 	}
-	mapSetNested(s.values, path, value)
-	notifiedSubs := make(map[string]bool)
-	for _, sub := range s.subscriptions {
-		if sub.subscribedTo(path) {
-			if _, ok := notifiedSubs[sub.name]; !ok {
-				notifiedSubs[sub.name] = true
-				sub.notify(s.values)
+	s.mu.Unlock()
+	err := run(nil)
+	s.deliver()
+	return err
+}
+
+// deferredUpdate is a change made by a callback while its notification was
+// being dispatched, queued until the end of the current round
+type deferredUpdate struct {
+	run   func(chain []string) error
+	chain []string
+}
+
+// applyDeferred calls the queued updates and reports their errors. Must be
+// called with the lock held, which is released meanwhile.
+func (s *State) applyDeferred() {
+	deferred := s.deferred
+	s.deferred = nil
+	s.mu.Unlock()
+	for _, u := range deferred {
+		if err := u.run(u.chain); err != nil {
+			s.report(u.chain[len(u.chain)-1], err)
+		}
+	}
+	s.mu.Lock()
+}
+
+// apply applies mutations made by a commit and records them in the history
+// and the action log. Must be called with the write lock held.
+func (s *State) apply(mutations []mutation, label string, chain []string) error {
+	changes, err := s.mutate(mutations, chain)
+	if err != nil {
+		return err
+	}
+	if s.history != nil {
+		s.history.record(changes)
+	}
+	s.logAction(changes, label)
+	return nil
+}
+
+// mutate applies mutations to the state values and queues the resulting
+// notifications, which are part of the cascade `chain`. If a derive function
+// fails, if the resulting values don't match the schema, if a mutation
+// requirement is not met, or if the mutations would make a cascade too deep,
+// the state values are left untouched and the error is returned. Must be
+// called with the write lock held.
+func (s *State) mutate(mutations []mutation, chain []string) ([]applied, error) {
+	if err := s.checkCascade(chain); err != nil {
+		return nil, err
+	}
+	paths := make([]Path, 0, len(mutations))
+	for _, m := range mutations {
+		paths = append(paths, m.path)
+	}
+	before := s.argsBefore(s.derivedPaths(paths))
+	values, changes, err := applyAll(s.values, mutations)
+	if err != nil {
+		return nil, err
+	}
+	if values, changes, err = s.recompute(values, changes); err != nil {
+		return nil, err
+	}
+	if s.schema != nil {
+		for _, c := range changes {
+			if err := s.schema.validateChange(values, c.Change); err != nil {
+				return nil, err
 			}
 		}
 	}
+	s.values = values
+	s.enqueue(changes, before, chain)
+	return changes, nil
 }
 
-// ClearNested removes a nested key from the state
-func (s *State) ClearNested(path Path) {
-	if len(path) == 0 {
+// argsBefore returns the current arguments of every subscription that is only
+// notified on value changes and that may be affected by changes to `paths`,
+// so that they can be compared with the arguments after the changes.
+func (s *State) argsBefore(paths []Path) map[*Subscription]CallbackArgs {
+	before := make(map[*Subscription]CallbackArgs)
+	matched := make(map[*Subscription]bool)
+	for _, path := range paths {
+		s.index.match(path, matched)
+	}
+	for sub := range matched {
+		if s.notifyModeOf(sub) == NotifyOnValueChange {
+			before[sub] = sub.args(s.values)
+		}
+	}
+	return before
+}
+
+// enqueue queues a notification for every subscription subscribed to any of
+// the changed paths, as part of the cascade `chain`. Subscriptions found in
+// `before` are skipped if their arguments did not change.
+func (s *State) enqueue(changes []applied, before map[*Subscription]CallbackArgs, chain []string) {
+	if len(changes) == 0 {
 		return
 	}
-	_, found := mapGetNested(s.values, path)
-	if !found {
+	s.seq++
+	matched := make(map[*Subscription]bool)
+	for _, c := range changes {
+		s.index.match(c.Path, matched)
+	}
+	for _, sub := range s.ordered(matched) {
+		event, ok := sub.event(s.seq, changes, s.values)
+		if !ok {
+			continue
+		}
+		if beforeArgs, found := before[sub]; found && reflect.DeepEqual(beforeArgs, event.Args) {
+			continue
+		}
+		s.pending = append(s.pending, notification{sub: sub, event: event, chain: chain})
+		s.queued++
+	}
+}
+
+// deliver dispatches, in order, the notifications queued before it was
+// called, and the ones queued by the changes that the callbacks it runs make,
+// and returns once they have all been dispatched. If a delivery is already in
+// progress, it returns right away and the notifications are delivered by it,
+// so that they are never dispatched out of order and no writer ever waits for
+// another one. A delivery that leaves notifications queued by other writers
+// hands them over to a new goroutine, so that a writer is not kept delivering
+// the notifications of other goroutines that keep changing the state.
+func (s *State) deliver() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.delivering || len(s.pending) == 0 {
 		return
 	}
-	mapClearNested(s.values, path)
-	notifiedSubs := make(map[string]bool)
-	for _, sub := range s.subscriptions {
-		if sub.subscribedTo(path) {
-			if _, ok := notifiedSubs[sub.name]; !ok {
-				notifiedSubs[sub.name] = true
-				sub.notify(s.values)
-			}
+	s.delivering = true
+	s.delivered = make(chan struct{})
+	defer func() {
+		s.delivering = false
+		close(s.delivered)
+		if len(s.pending) > 0 {
+			go s.deliver()
+		}
+	}()
+	ticket := s.queued
+	for s.dispatched < ticket && len(s.pending) > 0 {
+		n := s.pending[0]
+		s.pending = s.pending[1:]
+		d := s.dispatcherOf()
+		if _, inline := d.(SyncDispatcher); inline {
+			s.dispatching = &n
+		}
+		s.mu.Unlock()
+		d.Dispatch(n.sub, func() { s.notify(n) })
+		s.mu.Lock()
+		s.dispatching = nil
+		s.dispatched++
+		roundEnd := len(s.pending) == 0 || s.pending[0].event.Seq != n.event.Seq
+		if roundEnd && len(s.deferred) > 0 {
+			s.applyDeferred()
+			ticket = s.queued
 		}
 	}
 }
 
+// nested returns true if deliver is running a callback through a
+// SyncDispatcher. The state can't tell which goroutine calls it, so mutations
+// made meanwhile are taken as made by the callback, whether they are or not.
+// Must be called with the lock held.
+func (s *State) nested() bool {
+	return s.dispatching != nil
+}
+
 // Get returns the value for a specific key
 func (s *State) Get(key KeyString) (value interface{}, found bool) {
-	value, found = s.values[key]
-	return value, found
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, found = s.values.get(key)
+	return valueCopy(value), found
 }
 
 // GetNested returns the value for a nested key
 func (s *State) GetNested(keys ...KeyString) (value interface{}, found bool) {
-	return mapGetNested(s.values, keys)
-}
-
-// Subscribe adds a subscription to the state
-func (s *State) Subscribe(subscription *Subscription) {
-	s.subscriptions[subscription.name] = subscription
-}
-
-// Unsubscribe removes a subscription from the state
-func (s *State) Unsubscribe(subscriptionName string) {
-	delete(s.subscriptions, subscriptionName)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, found = pmapGetNested(s.values, keys)
+	return valueCopy(value), found
 }
 
-// AsMap returns a copy of the state as a map
+// AsMap returns a copy of the state as a map. The whole state is copied, use
+// Snapshot for a cheap read-only view.
 func (s *State) AsMap() CallbackArgs {
-	return mapDeepCopy(s.values)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values.toMap()
 }
 
 // NewState creates a new state
 func NewState() *State {
 	return &State{
-		subscriptions: make(map[string]*Subscription),
-		values:        make(map[KeyString]interface{}),
+		subscriptions: make(map[*Subscription]*registration),
+		names:         make(map[string]map[*Subscription]bool),
+		index:         newSubscriptionIndex(),
+		values:        &pmap{},
 	}
 }
 
 // NewStateFromMap creates a new state from a map
 func NewStateFromMap(m map[KeyString]interface{}) *State {
 	return &State{
-		subscriptions: make(map[string]*Subscription),
-		values:        mapDeepCopy(m),
+		subscriptions: make(map[*Subscription]*registration),
+		names:         make(map[string]map[*Subscription]bool),
+		index:         newSubscriptionIndex(),
+		values:        newPmap(m),
 	}
 }
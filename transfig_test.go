@@ -337,6 +337,27 @@ func Test_GetNested_LenghtTwoMissing(t *testing.T) {
 	assert.Nil(t, value)
 }
 
+func Test_Get_NestedValuesInSlicesAreCopies(t *testing.T) {
+	state := NewState()
+	jobs := []map[KeyString]interface{}{{Title: "Developer"}}
+	matrix := [][]int{{1, 2}}
+	state.Set(Job, jobs)
+	state.Set(Ammount, matrix)
+	jobs[0][Title] = "Manager"
+	matrix[0][0] = 3
+	value, _ := state.Get(Job)
+	assert.Equal(t, []map[KeyString]interface{}{{Title: "Developer"}}, value)
+	value.([]map[KeyString]interface{})[0][Title] = "Manager"
+	value, _ = state.Get(Ammount)
+	assert.Equal(t, [][]int{{1, 2}}, value)
+	value.([][]int)[0][0] = 3
+	snapshot := state.Snapshot()
+	value, _ = state.Get(Job)
+	assert.Equal(t, []map[KeyString]interface{}{{Title: "Developer"}}, value)
+	value, _ = snapshot.Get(Ammount)
+	assert.Equal(t, [][]int{{1, 2}}, value)
+}
+
 func Test_SetNested_Zero(t *testing.T) {
 	state := NewState()
 	state.SetNested(Path{}, "Mike")
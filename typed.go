@@ -0,0 +1,73 @@
+package transfig
+
+// Key is a typed path to a value in the state. It implements Selector, so it
+// can be used anywhere a Path can, and it is used by Get, Set and OnChange to
+// read and write values of type T without runtime type assertions in the
+// caller.
+type Key[T any] struct {
+	path Path
+}
+
+// NewKey creates a new typed key for the value at the given (nested) keys
+func NewKey[T any](keys ...KeyString) Key[T] {
+	return Key[T]{path: append(Path{}, keys...)}
+}
+
+// Path returns the path of the key
+func (k Key[T]) Path() Path {
+	return append(Path{}, k.path...)
+}
+
+// Select implements Selector
+func (k Key[T]) Select(m map[KeyString]interface{}) KeyValIter {
+	return k.path.Select(m)
+}
+
+// Contains implements Selector
+func (k Key[T]) Contains(p Path) bool {
+	return k.path.Contains(p)
+}
+
+func (k Key[T]) indexPath() Path {
+	return k.path
+}
+
+// Arg returns the value of the key in a subscription's arguments. The
+// boolean is false if the value is missing or is not a T.
+func (k Key[T]) Arg(args CallbackArgs) (T, bool) {
+	return GetArg[T](args, k.path...)
+}
+
+// Get returns the value of a typed key in the state. The boolean is false if
+// the value is missing or is not a T.
+func Get[T any](s *State, k Key[T]) (T, bool) {
+	var zero T
+	value, found := s.GetNested(k.path...)
+	if !found {
+		return zero, false
+	}
+	valueAsT, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+	return valueAsT, true
+}
+
+// Set sets the value of a typed key in the state
+func Set[T any](s *State, k Key[T], value T) {
+	s.SetNested(k.path, value)
+}
+
+// TrySet is like Set, but returns the error if the change is rejected
+func TrySet[T any](s *State, k Key[T], value T) error {
+	return s.TrySetNested(k.path, value)
+}
+
+// OnChange creates a new subscription to a typed key that calls `callback`
+// with the new value. The boolean passed to `callback` is false if the value
+// is missing or is not a T.
+func OnChange[T any](name string, k Key[T], callback func(value T, found bool)) *Subscription {
+	return NewSubscription(name).With(k).Calls(func(args CallbackArgs) {
+		callback(k.Arg(args))
+	})
+}
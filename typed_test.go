@@ -0,0 +1,70 @@
+package transfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+var (
+	NameKey  = NewKey[string](Name)
+	AgeKey   = NewKey[int](Age)
+	TitleKey = NewKey[string](Job, Title)
+)
+
+func Test_Key_GetSet(t *testing.T) {
+	state := DefaultState()
+	name, found := Get(state, NameKey)
+	assert.True(t, found)
+	assert.Equal(t, "John", name)
+
+	Set(state, TitleKey, "Developer")
+	title, found := Get(state, TitleKey)
+	assert.True(t, found)
+	assert.Equal(t, "Developer", title)
+}
+
+func Test_Key_GetWrongType(t *testing.T) {
+	state := DefaultState()
+	state.Set(Age, "thirty")
+	age, found := Get(state, AgeKey)
+	assert.False(t, found)
+	assert.Equal(t, 0, age)
+}
+
+func Test_Key_GetMissing(t *testing.T) {
+	state := DefaultState()
+	title, found := Get(state, TitleKey)
+	assert.False(t, found)
+	assert.Equal(t, "", title)
+}
+
+func Test_Key_TrySetRejected(t *testing.T) {
+	state := DefaultState()
+	state.Use(rejectAge)
+	assert.ErrorIs(t, TrySet(state, AgeKey, 40), errRejected)
+}
+
+func Test_Key_AsSelector(t *testing.T) {
+	state := DefaultState()
+	callbackArgs := CallbackArgs{}
+	state.Subscribe(NewSubscription("subName").With(TitleKey).Calls(func(args CallbackArgs) { callbackArgs = args }))
+	state.SetNested(Path{Job, Title}, "Developer")
+	title, found := TitleKey.Arg(callbackArgs)
+	assert.True(t, found)
+	assert.Equal(t, "Developer", title)
+}
+
+func Test_OnChange(t *testing.T) {
+	state := DefaultState()
+	values := []int{}
+	state.Subscribe(OnChange("subName", AgeKey, func(age int, found bool) {
+		assert.True(t, found)
+		values = append(values, age)
+	}))
+	Set(state, AgeKey, 31)
+	state.Set(Name, "Mike")
+	Set(state, AgeKey, 32)
+	assert.Equal(t, []int{31, 32}, values)
+}
@@ -0,0 +1,124 @@
+package transfig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultWatchSize is the channel buffer size used by State.Watch
+const DefaultWatchSize = 16
+
+// OverflowPolicy decides what happens when a watch channel is full and a new
+// event arrives
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the event can be sent. While waiting, the
+	// delivery of all notifications of the state is blocked. With
+	// SyncDispatcher, mutations made meanwhile by any goroutine are queued
+	// until the event is sent (see State).
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest event in the channel to make
+	// room for the new one.
+	OverflowDropOldest
+	// OverflowCoalesce keeps at most one event in the channel. An event that
+	// was not received yet is replaced by the new one, whose Changes are
+	// prepended with the Changes of the replaced event. The buffer size is
+	// ignored.
+	OverflowCoalesce
+)
+
+// WatchOptions configure a watch channel
+type WatchOptions struct {
+	// Size is the channel buffer size. It is at least 1 with
+	// OverflowDropOldest.
+	Size     int
+	Overflow OverflowPolicy
+}
+
+// Watch returns a channel that receives a ChangeEvent whenever the values
+// selected by `selectors` change, as a subscription with the same selectors
+// would. The subscription is named "watch:" followed by a number unique to
+// the watch. The channel has a buffer of DefaultWatchSize events and blocks
+// when full, as with OverflowBlock. When `ctx` is done, the subscription is
+// removed and the channel is closed.
+func (s *State) Watch(ctx context.Context, selectors ...Selector) <-chan ChangeEvent {
+	return s.WatchWith(ctx, WatchOptions{Size: DefaultWatchSize}, selectors...)
+}
+
+// WatchWith is Watch with explicit options
+func (s *State) WatchWith(ctx context.Context, options WatchOptions, selectors ...Selector) <-chan ChangeEvent {
+	size := options.Size
+	switch {
+	case options.Overflow == OverflowCoalesce:
+		size = 1
+	case options.Overflow == OverflowDropOldest && size < 1:
+		size = 1
+	case size < 0:
+		size = 0
+	}
+	w := &watch{ctx: ctx, ch: make(chan ChangeEvent, size), overflow: options.Overflow}
+	sub := NewSubscription("").CallsWithEvent(w.send)
+	sub.name = fmt.Sprintf("watch:%d", sub.serial)
+	for _, selector := range selectors {
+		sub.With(selector)
+	}
+	handle := s.Subscribe(sub)
+	go func() {
+		<-ctx.Done()
+		handle.Cancel()
+		w.close()
+	}()
+	return w.ch
+}
+
+// watch sends the events of a subscription to a channel
+type watch struct {
+	ctx      context.Context
+	mu       sync.Mutex
+	ch       chan ChangeEvent
+	overflow OverflowPolicy
+	closed   bool
+}
+
+// send sends an event to the channel, according to the overflow policy
+func (w *watch) send(event ChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	switch w.overflow {
+	case OverflowBlock:
+		select {
+		case w.ch <- event:
+		case <-w.ctx.Done():
+		}
+		return
+	case OverflowCoalesce:
+		select {
+		case old := <-w.ch:
+			event.Changes = append(old.Changes, event.Changes...)
+		default:
+		}
+	}
+	for {
+		select {
+		case w.ch <- event:
+			return
+		default:
+		}
+		select {
+		case <-w.ch:
+		default:
+		}
+	}
+}
+
+func (w *watch) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	close(w.ch)
+}
@@ -0,0 +1,128 @@
+package transfig_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/vitorqb/transfig"
+)
+
+// receive returns the next event in the channel, failing if there is none
+func receive(t *testing.T, ch <-chan ChangeEvent) ChangeEvent {
+	select {
+	case event, ok := <-ch:
+		assert.True(t, ok, "channel closed")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return ChangeEvent{}
+}
+
+func Test_Watch(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := state.Watch(ctx, Name)
+	state.Set(Age, 31)
+	state.Set(Name, "Mike")
+	event := receive(t, ch)
+	assert.Equal(t, CallbackArgs{Name: "Mike"}, event.Args)
+	assert.Equal(t, Path{Name}, event.Path)
+	assert.Len(t, ch, 0)
+}
+
+func Test_Watch_DistinctNames(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := state.Watch(ctx, Name)
+	second := state.Watch(ctx, Name)
+	subscriptions := state.Subscriptions()
+	assert.Len(t, subscriptions, 2)
+	assert.NotEqual(t, subscriptions[0].Name, subscriptions[1].Name)
+
+	state.Unsubscribe(subscriptions[0].Name)
+	state.Set(Name, "Mike")
+	assert.Len(t, first, 0)
+	assert.Equal(t, CallbackArgs{Name: "Mike"}, receive(t, second).Args)
+}
+
+func Test_Watch_ClosedWhenContextDone(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := state.Watch(ctx, Name)
+	cancel()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed")
+	}
+	state.Set(Name, "Mike")
+}
+
+func Test_Watch_Block(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := state.WatchWith(ctx, WatchOptions{Size: 1}, Name)
+	done := make(chan struct{})
+	go func() {
+		state.Set(Name, "Mike")
+		state.Set(Name, "Paul")
+		close(done)
+	}()
+	assert.Equal(t, "Mike", receive(t, ch).Args[Name])
+	assert.Equal(t, "Paul", receive(t, ch).Args[Name])
+	<-done
+}
+
+func Test_Watch_BlockUnblockedByContext(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := state.WatchWith(ctx, WatchOptions{Size: 0}, Name)
+	done := make(chan struct{})
+	go func() {
+		state.Set(Name, "Mike")
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Set still blocked")
+	}
+	for range ch {
+	}
+}
+
+func Test_Watch_DropOldest(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := state.WatchWith(ctx, WatchOptions{Size: 2, Overflow: OverflowDropOldest}, Name)
+	for _, name := range []string{"Mike", "Paul", "Anna"} {
+		state.Set(Name, name)
+	}
+	assert.Equal(t, "Paul", receive(t, ch).Args[Name])
+	assert.Equal(t, "Anna", receive(t, ch).Args[Name])
+	assert.Len(t, ch, 0)
+}
+
+func Test_Watch_Coalesce(t *testing.T) {
+	state := DefaultState()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := state.WatchWith(ctx, WatchOptions{Size: 10, Overflow: OverflowCoalesce}, Name, Age)
+	state.Set(Name, "Mike")
+	state.Set(Age, 31)
+	state.Set(Name, "Paul")
+	event := receive(t, ch)
+	assert.Equal(t, CallbackArgs{Name: "Paul", Age: 31}, event.Args)
+	assert.Len(t, event.Changes, 3)
+	assert.Equal(t, "Paul", event.NewValue)
+	assert.Len(t, ch, 0)
+}